@@ -3,81 +3,32 @@
 package api
 
 import (
-	"bytes"
-	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os"
-	"strconv"
-
-	"github.com/juju/errors"
+	"github.com/juju/juju/api/fakejuju"
 )
 
+// A minimal client for the fake-jujud control plane API, kept for
+// backward compatibility. See the github.com/juju/juju/api/fakejuju
+// package for a complete client.
 type FakeJujuClient struct {
-
-	// The fake-jujud control plane API port on localhost to connect to
-	port int
+	*fakejuju.Client
 }
 
 // Get a new client using the default port or the one from the FAKE_JUJUD_PORT
 // environment variable.
 func NewFakeJujuClient() (*FakeJujuClient, error) {
-	port, err := GetFakeJujudPort()
+	client, err := fakejuju.NewClient()
 	if err != nil {
 		return nil, err
 	}
-	return NewFakeJujuClientWithPort(port), nil
+	return &FakeJujuClient{client}, nil
 }
 
 // Get a new client pointing to the given port.
 func NewFakeJujuClientWithPort(port int) *FakeJujuClient {
-	return &FakeJujuClient{port: port}
-}
-
-// Perform a new controller bootstrap
-func (c *FakeJujuClient) Bootstrap() error {
-	return c.post("bootstrap")
-}
-
-// Destroy the running controller
-func (c *FakeJujuClient) Destroy() error {
-	return c.post("destroy")
-}
-
-// Perform a POST HTTP request against the fake-juju control API
-func (c *FakeJujuClient) post(path string) error {
-	url := fmt.Sprintf("http://127.0.0.1:%d/%s", c.port, path)
-
-	logger.Debugf("Performing fake-juju request at %s", url)
-	response, err := http.Post(url, "", bytes.NewBuffer([]byte("")))
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
-
-	logger.Debugf("Got response Status: %s", response.Status)
-
-	if response.StatusCode != 200 {
-		data, err := ioutil.ReadAll(response.Body)
-		message := string(data)
-		if err != nil {
-			message = err.Error()
-		}
-		return errors.New(
-			fmt.Sprintf("Failed fake-juju request: %s", message))
-	}
-
-	return nil
+	return &FakeJujuClient{fakejuju.NewClientWithPort(port)}
 }
 
 // Figure the port that fake-jujud is listening to.
 func GetFakeJujudPort() (port int, err error) {
-	port = 17100 // the default
-	if os.Getenv("FAKE_JUJUD_PORT") != "" {
-		port, err = strconv.Atoi(os.Getenv("FAKE_JUJUD_PORT"))
-		if err != nil {
-			return 0, errors.Annotate(err, "invalid port number")
-		}
-	}
-	return port, nil
+	return fakejuju.GetPort()
 }
@@ -0,0 +1,420 @@
+// Package fakejuju implements a client for the fake-jujud control plane
+// API, which tests can use to drive a fake-jujud process (bootstrap and
+// destroy controllers, inject failures, wait for entities to reach a
+// certain state, etc). The request and response types are defined in the
+// params subpackage, which fake-jujud uses as well.
+package fakejuju
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+
+	"github.com/juju/juju/api/fakejuju/params"
+)
+
+var logger = loggo.GetLogger("juju.api.fakejuju")
+
+// The default fake-jujud control plane API port.
+const DefaultPort = 17100
+
+// A client for the fake-jujud control plane API.
+type Client struct {
+
+	// The base URL of the control plane API
+	url string
+
+	// The UUID of the model that requests act on, if not the controller
+	// model (see Client.Model).
+	model string
+
+	http *http.Client
+}
+
+// Get a new client using the default port or the one from the
+// FAKE_JUJUD_PORT environment variable.
+func NewClient() (*Client, error) {
+	port, err := GetPort()
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithPort(port), nil
+}
+
+// Get a new client pointing to the given port on localhost.
+func NewClientWithPort(port int) *Client {
+	return &Client{
+		url:  fmt.Sprintf("http://127.0.0.1:%d", port),
+		http: &http.Client{},
+	}
+}
+
+// Figure the port that fake-jujud is listening to.
+func GetPort() (port int, err error) {
+	port = DefaultPort
+	if os.Getenv("FAKE_JUJUD_PORT") != "" {
+		port, err = strconv.Atoi(os.Getenv("FAKE_JUJUD_PORT"))
+		if err != nil {
+			return 0, errors.Annotate(err, "invalid port number")
+		}
+	}
+	return port, nil
+}
+
+// Perform a new controller bootstrap
+func (c *Client) Bootstrap() error {
+	return c.call("POST", "/bootstrap", nil, nil)
+}
+
+// Destroy the running controller
+func (c *Client) Destroy() error {
+	return c.call("POST", "/destroy", nil, nil)
+}
+
+// Remove all applications, units, machines and actions from the model,
+// without destroying the controller.
+func (c *Client) Reset() error {
+	return c.call("POST", "/reset", nil, nil)
+}
+
+// Return the connection information of the bootstrapped controller.
+func (c *Client) ControllerInfo() (*params.Controller, error) {
+	controller := &params.Controller{}
+	if err := c.call("GET", "/controller", nil, controller); err != nil {
+		return nil, err
+	}
+	return controller, nil
+}
+
+// Return the named controllers, hosted by child fake-jujud processes.
+func (c *Client) Controllers() ([]params.NamedController, error) {
+	var controllers []params.NamedController
+	err := c.call("GET", "/controllers", nil, &controllers)
+	return controllers, err
+}
+
+// Return a client for the named controller with the given name. Its
+// Bootstrap method starts a child fake-jujud process hosting the
+// controller, and its Destroy method stops it.
+func (c *Client) Controller(name string) *Client {
+	return &Client{
+		url:  c.url + "/controllers/" + name,
+		http: c.http,
+	}
+}
+
+// Return a client whose requests act on the model with the given UUID,
+// instead of the controller model.
+func (c *Client) Model(uuid string) *Client {
+	return &Client{
+		url:   c.url,
+		model: uuid,
+		http:  c.http,
+	}
+}
+
+// Return the machines in the model.
+func (c *Client) Machines() ([]params.Machine, error) {
+	var machines []params.Machine
+	err := c.call("GET", "/machines", nil, &machines)
+	return machines, err
+}
+
+// Return the units in the model.
+func (c *Client) Units() ([]params.Unit, error) {
+	var units []params.Unit
+	err := c.call("GET", "/units", nil, &units)
+	return units, err
+}
+
+// Return the actions in the model.
+func (c *Client) Actions() ([]params.Action, error) {
+	var actions []params.Action
+	err := c.call("GET", "/actions", nil, &actions)
+	return actions, err
+}
+
+// Return the relations in the model.
+func (c *Client) Relations() ([]params.Relation, error) {
+	var relations []params.Relation
+	err := c.call("GET", "/relations", nil, &relations)
+	return relations, err
+}
+
+// Return the settings of the given unit in the relation with the given ID.
+func (c *Client) RelationSettings(id int, unit string) (map[string]interface{}, error) {
+	var settings map[string]interface{}
+	err := c.call("GET", relationSettingsPath(id, unit), nil, &settings)
+	return settings, err
+}
+
+// Set the settings of the given unit in the relation with the given ID.
+// Values must be strings, nil values delete the setting.
+func (c *Client) SetRelationSettings(id int, unit string, settings map[string]interface{}) error {
+	return c.call("POST", relationSettingsPath(id, unit), settings, nil)
+}
+
+// Return the name of the unit holding the leadership of the given
+// application, or an empty string if there's none.
+func (c *Client) ApplicationLeader(application string) (string, error) {
+	leader := params.Leader{}
+	err := c.call("GET", "/applications/"+application+"/leader", nil, &leader)
+	return leader.Unit, err
+}
+
+// Make the given unit the leader of the given application. This blocks
+// until the unit holds the leadership, which happens once the lease of the
+// current leader expires, within a few seconds.
+func (c *Client) SetApplicationLeader(application, unit string) error {
+	body := params.Leader{Unit: unit}
+	return c.call("POST", "/applications/"+application+"/leader", body, nil)
+}
+
+// Return the leader settings of the given application.
+func (c *Client) LeaderSettings(application string) (map[string]string, error) {
+	var settings map[string]string
+	err := c.call("GET", "/applications/"+application+"/leader-settings", nil, &settings)
+	return settings, err
+}
+
+// Update the leader settings of the given application. Empty values delete
+// the setting.
+func (c *Client) SetLeaderSettings(application string, settings map[string]string) error {
+	return c.call("POST", "/applications/"+application+"/leader-settings", settings, nil)
+}
+
+// Schedule the given entity (e.g. "unit-mysql-0" or "machine-1") to fail
+// as described by the given failure. The entity belongs to the model set
+// in failure.Model, or to the controller model if that's empty.
+func (c *Client) Fail(entity string, failure params.Failure) error {
+	return c.call("POST", "/fail/"+entity, failure, nil)
+}
+
+// Remove the failure scheduled for the given entity.
+func (c *Client) RemoveFailure(entity string) error {
+	return c.call("DELETE", "/fail/"+entity, nil, nil)
+}
+
+// Remove the failure scheduled for the given entity of the model with
+// the given UUID, whatever the model of the client.
+func (c *Client) RemoveModelFailure(model, entity string) error {
+	return c.call("DELETE", "/fail/"+entity+modelQuery(model), nil, nil)
+}
+
+// Return the scheduled failures, in all models (or in the model of the
+// client, see Client.Model).
+func (c *Client) Failures() ([]params.Failure, error) {
+	return c.ModelFailures("")
+}
+
+// Return the failures scheduled in the model with the given UUID. If the
+// UUID is empty, this is the same as Failures.
+func (c *Client) ModelFailures(model string) ([]params.Failure, error) {
+	var failures []params.Failure
+	err := c.call("GET", "/failures"+modelQuery(model), nil, &failures)
+	return failures, err
+}
+
+// Remove all scheduled failures, in all models (or in the model of the
+// client, see Client.Model).
+func (c *Client) ClearFailures() error {
+	return c.ClearModelFailures("")
+}
+
+// Remove the failures scheduled in the model with the given UUID. If the
+// UUID is empty, this is the same as ClearFailures.
+func (c *Client) ClearModelFailures(model string) error {
+	return c.call("DELETE", "/failures"+modelQuery(model), nil, nil)
+}
+
+// Register the result that matching actions should complete with.
+func (c *Client) SetActionResult(result params.ActionResult) error {
+	return c.call("POST", "/action-results", result, nil)
+}
+
+// Return the registered action results.
+func (c *Client) ActionResults() ([]params.ActionResult, error) {
+	var results []params.ActionResult
+	err := c.call("GET", "/action-results", nil, &results)
+	return results, err
+}
+
+// Remove all registered action results.
+func (c *Client) ClearActionResults() error {
+	return c.call("DELETE", "/action-results", nil, nil)
+}
+
+// Return the current latency settings.
+func (c *Client) Latencies() (params.Latencies, error) {
+	var latencies params.Latencies
+	err := c.call("GET", "/latencies", nil, &latencies)
+	return latencies, err
+}
+
+// Replace the latency settings.
+func (c *Client) SetLatencies(latencies params.Latencies) error {
+	return c.call("POST", "/latencies", latencies, nil)
+}
+
+// Start playing the given YAML scenario, replacing the current one.
+func (c *Client) PlayScenario(scenario []byte) error {
+	return c.call("POST", "/scenario", scenario, nil)
+}
+
+// Stop playing the current scenario.
+func (c *Client) StopScenario() error {
+	return c.call("DELETE", "/scenario", nil, nil)
+}
+
+// Replace the rules describing how units react to changes with the given
+// YAML ones.
+func (c *Client) SetRules(rules []byte) error {
+	return c.call("POST", "/rules", rules, nil)
+}
+
+// Remove all rules.
+func (c *Client) ClearRules() error {
+	return c.call("DELETE", "/rules", nil, nil)
+}
+
+// Start the given pending machine.
+func (c *Client) StartMachine(id string) error {
+	return c.call("POST", "/machines/"+id+"/start", nil, nil)
+}
+
+// Start the given allocating unit (e.g. "mysql/0").
+func (c *Client) StartUnit(name string) error {
+	return c.call("POST", "/units/"+unitPath(name)+"/start", nil, nil)
+}
+
+// Set the agent and/or workload status of the given unit. Nil statuses
+// are left unchanged.
+func (c *Client) SetUnitStatus(name string, agent, workload *params.Status) error {
+	body := params.UnitStatusRequest{Agent: agent, Workload: workload}
+	return c.call("POST", "/units/"+unitPath(name)+"/status", body, nil)
+}
+
+// Complete the given pending action. If result is nil, the registered
+// result (if any) will be used.
+func (c *Client) CompleteAction(id string, result *params.ActionResult) error {
+	var body interface{}
+	if result != nil {
+		body = result
+	}
+	return c.call("POST", "/actions/"+id+"/complete", body, nil)
+}
+
+// Block until the given condition (e.g. "unit mysql/0 workload=active") is
+// satisfied or the timeout expires. In the latter case a *TimeoutError is
+// returned, holding the last observed state. Values containing spaces must
+// be double-quoted (e.g. `workload-message="missing relations: db"`).
+func (c *Client) Wait(condition string, timeout time.Duration) (*params.WaitResult, error) {
+	body := params.WaitRequest{Condition: condition, Timeout: timeout.String()}
+	result := &params.WaitResult{}
+	if err := c.call("POST", "/wait", body, result); err != nil {
+		return nil, err
+	}
+	if !result.Matched {
+		return result, &TimeoutError{Condition: condition, Result: result}
+	}
+	return result, nil
+}
+
+// Perform an HTTP request against the control plane API. If body is not
+// nil it will be sent JSON-encoded, and if result is not nil the response
+// body will be JSON-decoded into it.
+func (c *Client) call(method, path string, body, result interface{}) error {
+	response, err := c.do(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// Perform an HTTP request against the control plane API, returning an
+// *Error if the response status is not 200. Requests act on the model of
+// the client (see Client.Model), unless the given path selects a model
+// itself.
+func (c *Client) do(method, path string, body interface{}) (*http.Response, error) {
+	target, err := url.Parse(c.url + path)
+	if err != nil {
+		return nil, err
+	}
+	query := target.Query()
+	if c.model != "" && query.Get("model") == "" {
+		query.Set("model", c.model)
+		target.RawQuery = query.Encode()
+	}
+
+	var reader io.Reader = &bytes.Buffer{}
+	if data, ok := body.([]byte); ok {
+		// Raw body, e.g. a YAML scenario
+		reader = bytes.NewReader(data)
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("Performing fake-juju request %s %s", method, target)
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("Got response Status: %s", response.Status)
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		data, err := ioutil.ReadAll(response.Body)
+		message := strings.TrimSpace(string(data))
+		if err != nil {
+			message = err.Error()
+		}
+		return nil, &Error{StatusCode: response.StatusCode, Message: message}
+	}
+
+	return response, nil
+}
+
+// Convert a unit name (e.g. "mysql/0") to the form used in URLs
+// (e.g. "mysql-0").
+func unitPath(name string) string {
+	return strings.Replace(name, "/", "-", -1)
+}
+
+// Return the query string selecting the model with the given UUID, if any.
+func modelQuery(model string) string {
+	if model == "" {
+		return ""
+	}
+	return "?" + url.Values{"model": {model}}.Encode()
+}
+
+// Return the URL path of the settings of the given unit in the relation with
+// the given ID.
+func relationSettingsPath(id int, unit string) string {
+	return fmt.Sprintf("/relations/%d/units/%s/settings", id, unitPath(unit))
+}
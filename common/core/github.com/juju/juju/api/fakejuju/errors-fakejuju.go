@@ -0,0 +1,42 @@
+// Errors returned by the fake-jujud control plane API client
+
+package fakejuju
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/juju/juju/api/fakejuju/params"
+)
+
+// An error response from the control plane API.
+type Error struct {
+	StatusCode int    // The HTTP status code
+	Message    string // The response body
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Failed fake-juju request: %s", e.Message)
+}
+
+// Returned by Client.Wait if the condition is not satisfied in time.
+type TimeoutError struct {
+	Condition string
+	Result    *params.WaitResult // Holds the last observed state
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout waiting for %s", e.Condition)
+}
+
+// Whether the error is due to the requested item not being found.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// Whether the error is due to a wait condition not being satisfied in time.
+func IsTimeout(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
@@ -0,0 +1,66 @@
+// Consume the fake-jujud event stream
+
+package fakejuju
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api/fakejuju/params"
+)
+
+// A stream of events published by fake-jujud.
+type EventStream struct {
+	response *http.Response
+	reader   *bufio.Reader
+}
+
+// Open a stream of the events published by fake-jujud. The stream ends
+// (and Next returns io.EOF) when the controller gets destroyed.
+func (c *Client) Events() (*EventStream, error) {
+	response, err := c.do("GET", "/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{
+		response: response,
+		reader:   bufio.NewReader(response.Body),
+	}, nil
+}
+
+// Block until the next event is received.
+func (s *EventStream) Next() (*params.Event, error) {
+	var data string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" {
+				return nil, io.EOF
+			}
+			return nil, errors.Annotate(err, "cannot read event")
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" && data != "" {
+			// A blank line terminates the event.
+			break
+		}
+		if strings.HasPrefix(line, "data: ") {
+			data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+	event := &params.Event{}
+	if err := json.Unmarshal([]byte(data), event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Close the stream.
+func (s *EventStream) Close() error {
+	return s.response.Body.Close()
+}
@@ -0,0 +1,283 @@
+// Package params holds the request and response types of the fake-jujud
+// control plane API. They're shared by fake-jujud itself and by the client
+// in the github.com/juju/juju/api/fakejuju package, so the two always agree
+// on the wire format.
+package params
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Status of an entity.
+type Status struct {
+	Status  string                 `json:"status"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	Since   *time.Time             `json:"since,omitempty"`
+}
+
+// Connection information for a bootstrapped controller.
+type Controller struct {
+	ControllerUUID string   `json:"controller-uuid"`
+	ModelUUID      string   `json:"model-uuid"`
+	Addresses      []string `json:"addresses"`
+	CACert         string   `json:"ca-cert"`
+	User           string   `json:"user"`
+	Password       string   `json:"password"`
+}
+
+// A named controller, hosted by a child fake-jujud process.
+type NamedController struct {
+	Name             string `json:"name"`
+	ControllerUUID   string `json:"controller-uuid"`
+	APIPort          int    `json:"api-port"`
+	ControlPlanePort int    `json:"control-plane-port"`
+}
+
+// A machine in a model.
+type Machine struct {
+	Id             string `json:"id"`
+	Life           string `json:"life"`
+	Series         string `json:"series"`
+	InstanceId     string `json:"instance-id"`
+	Status         Status `json:"status"`
+	InstanceStatus Status `json:"instance-status"`
+}
+
+// A unit in a model.
+type Unit struct {
+	Name           string `json:"name"`
+	Application    string `json:"application"`
+	Machine        string `json:"machine"`
+	Life           string `json:"life"`
+	AgentStatus    Status `json:"agent-status"`
+	WorkloadStatus Status `json:"workload-status"`
+}
+
+// A relation in a model.
+type Relation struct {
+	Id        int      `json:"id"`
+	Key       string   `json:"key"`
+	Life      string   `json:"life"`
+	Endpoints []string `json:"endpoints"`
+
+	// The units in the relation scope.
+	Units []string `json:"units"`
+}
+
+// An action enqueued on a unit.
+type Action struct {
+	Id         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Receiver   string                 `json:"receiver"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Status     string                 `json:"status"`
+	Message    string                 `json:"message,omitempty"`
+	Results    map[string]interface{} `json:"results,omitempty"`
+	Enqueued   time.Time              `json:"enqueued"`
+	Completed  time.Time              `json:"completed"`
+}
+
+// Possible values for Failure.Target
+const (
+	FailureTargetAgent    = "agent"    // Set the agent status to error
+	FailureTargetWorkload = "workload" // Set the workload status to error
+)
+
+// Details about how an entity should fail.
+type Failure struct {
+
+	// The entity that should fail, e.g. "unit-mysql-0".
+	Entity string `json:"entity"`
+
+	// The UUID of the model that the entity belongs to. If empty when
+	// setting a failure, the controller model will be used.
+	Model string `json:"model,omitempty"`
+
+	// The status message to set. If empty, a default message will be
+	// used, mentioning the failed hook (if any). For machines this is
+	// the provisioning error, e.g. "no matching tools available".
+	Message string `json:"message,omitempty"`
+
+	// The name of the hook whose failure is being simulated, for
+	// example "install", "config-changed" or "relation-joined".
+	Hook string `json:"hook,omitempty"`
+
+	// Which status should be set to error, either "agent" (the default,
+	// mimicking a hook error) or "workload".
+	Target string `json:"target,omitempty"`
+
+	// Additional status data. For hook errors juju attaches the hook
+	// name (automatically filled from the Hook field) and, for relation
+	// hooks, the "relation-id" and "remote-unit" keys.
+	Data map[string]interface{} `json:"data,omitempty"`
+
+	// Rather than erroring, keep the entity dying once it's destroyed,
+	// until the failure is removed.
+	StuckDying bool `json:"stuck-dying,omitempty"`
+}
+
+// Check that the failure details are consistent.
+func (f *Failure) Validate() error {
+	switch f.Target {
+	case "", FailureTargetAgent, FailureTargetWorkload:
+	default:
+		return errors.NotValidf("failure target %q", f.Target)
+	}
+	return nil
+}
+
+// The outcome that an action should have when fake-jujud completes it.
+type ActionResult struct {
+
+	// The name of the charm action this result applies to.
+	Action string `json:"action"`
+
+	// Optionally, the name of the unit this result applies to (e.g.
+	// "mysql/0"). Unit-specific results take precedence over the ones
+	// that apply to all units.
+	Unit string `json:"unit,omitempty"`
+
+	// The final status of the action, either "completed" (the default),
+	// "failed" or "cancelled".
+	Status string `json:"status,omitempty"`
+
+	// The action output.
+	Results map[string]interface{} `json:"results,omitempty"`
+
+	// The failure message, if any.
+	Message string `json:"message,omitempty"`
+}
+
+// Check that the action result details are consistent.
+func (r *ActionResult) Validate() error {
+	if r.Action == "" {
+		return errors.NotValidf("empty action name")
+	}
+	return r.ValidateStatus()
+}
+
+// Check that the action status is one of a finished action.
+func (r *ActionResult) ValidateStatus() error {
+	switch r.Status {
+	case "", "completed", "failed", "cancelled":
+	default:
+		return errors.NotValidf("action status %q", r.Status)
+	}
+	return nil
+}
+
+// How long fake-jujud should wait before transitioning an entity.
+type Latency struct {
+	Delay  time.Duration // Fixed delay
+	Jitter time.Duration // Maximum random delay added to the fixed one
+}
+
+// Latencies are encoded in JSON using duration strings like "1.5s".
+type latencyJSON struct {
+	Delay  string `json:"delay,omitempty"`
+	Jitter string `json:"jitter,omitempty"`
+}
+
+func (l Latency) MarshalJSON() ([]byte, error) {
+	value := latencyJSON{}
+	if l.Delay != 0 {
+		value.Delay = l.Delay.String()
+	}
+	if l.Jitter != 0 {
+		value.Jitter = l.Jitter.String()
+	}
+	return json.Marshal(value)
+}
+
+func (l *Latency) UnmarshalJSON(data []byte) error {
+	var value latencyJSON
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	var err error
+	if value.Delay != "" {
+		if l.Delay, err = time.ParseDuration(value.Delay); err != nil {
+			return err
+		}
+	}
+	if value.Jitter != "" {
+		if l.Jitter, err = time.ParseDuration(value.Jitter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Latency settings for the various entity kinds.
+type Latencies struct {
+	Machine Latency `json:"machine"` // From pending to started
+	Unit    Latency `json:"unit"`    // From allocating to idle/active
+	Action  Latency `json:"action"`  // From pending to completed
+	Removal Latency `json:"removal"` // From dying to removed
+
+	// Per-application overrides of the unit latency.
+	Applications map[string]Latency `json:"applications,omitempty"`
+}
+
+// Request body for the wait endpoint.
+type WaitRequest struct {
+	Condition string `json:"condition"`         // E.g. "unit mysql/0 workload=active"
+	Timeout   string `json:"timeout,omitempty"` // Defaults to one minute
+}
+
+// Outcome of waiting for a condition.
+type WaitResult struct {
+	Matched bool `json:"matched"`
+
+	// The last observed state of the entity, if any, which is a
+	// JSON-encoded Machine, Unit or Action, depending on the condition.
+	State json.RawMessage `json:"state,omitempty"`
+}
+
+// Decode the last observed state of the entity into the given value,
+// which should be a *Machine, *Unit or *Action.
+func (r *WaitResult) Decode(value interface{}) error {
+	return json.Unmarshal(r.State, value)
+}
+
+// Request body for the units/:unit/status endpoint. Omitted statuses are
+// left unchanged.
+type UnitStatusRequest struct {
+	Agent    *Status `json:"agent,omitempty"`
+	Workload *Status `json:"workload,omitempty"`
+}
+
+// Request and response body of the applications/:app/leader endpoint.
+type Leader struct {
+	Unit string `json:"unit"`
+}
+
+// Possible values for Event.Type
+const (
+	EventTypeDelta      = "delta"      // A delta received by the watch loop
+	EventTypeTransition = "transition" // A transition applied to an entity
+)
+
+// An event published by fake-jujud.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"` // The entity kind, e.g. "unit"
+	Id   string    `json:"id"`   // The entity ID, e.g. "mysql/0"
+
+	// For delta events, whether the entity was removed and the
+	// JSON-encoded entity info carried by the delta.
+	Removed bool            `json:"removed,omitempty"`
+	Entity  json.RawMessage `json:"entity,omitempty"`
+
+	// For transition events, the name of the transition (e.g. "start")
+	// and the resulting status (e.g. "active"). For relation transitions
+	// (e.g. "enter-scope" or "leave-scope"), the status is the name of the
+	// unit.
+	Transition string `json:"transition,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
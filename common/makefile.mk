@@ -56,8 +56,12 @@ overlay: src
 	find src/ -name *-fakejuju.go -delete
 
 	# Then create new symlinks against our overlay Go source files.
+	# Directories are created as needed, for packages that exist only
+	# in the overlay.
 	for name in $(shell find ../common/core/ -name "*.go"); \
-		do ln -s $$(pwd)/$$name src/$$(echo $$name | sed -e "s|^../common/core/||"); \
+		do target=src/$$(echo $$name | sed -e "s|^../common/core/||"); \
+		mkdir -p $$(dirname $$target); \
+		ln -s $$(pwd)/$$name $$target; \
 	done
 
 # Apply quilt patches to the upstream source tree
@@ -3,35 +3,126 @@
 package service
 
 import (
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api/fakejuju/params"
 	"github.com/juju/juju/state"
 )
 
-// Handle a changed action
-func (s *FakeJujuService) handleActionChanged(id string) error {
+// Handle a changed action in the model of the given state
+func (s *FakeJujuService) handleActionChanged(st *state.State, id string) error {
 	log.Infof("Handling changed action %s", id)
 
 	// Get the action
-	action, err := s.state.Action(id)
+	action, err := st.Action(id)
+	if errors.IsNotFound(err) {
+		// The action was removed in the meantime (for example along
+		// with its unit), we'll get a delta about the removal.
+		log.Infof("Action %s is gone", id)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if action.Status() == state.ActionPending {
-		return s.completeAction(action)
+	if action.Status() != state.ActionPending || s.options.Manual {
+		return nil
+	}
+	if s.isDue(st, "complete", "action", id, s.latencies.Action) {
+		return s.completeAction(action, s.actionResult(st, action))
 	}
 
 	return nil
 }
 
-// Start a action (i.e. transition it from waiting to active)
-func (s *FakeJujuService) completeAction(action state.Action) error {
+// Complete an action (i.e. transition it from pending to completed). If
+// a result is given, it will be used to finish the action, otherwise the
+// action will complete successfully with a fixed output.
+func (s *FakeJujuService) completeAction(action state.Action, result *params.ActionResult) error {
 	log.Infof("Completing action %s", action.Id())
 
-	output := map[string]interface{}{"output": "action ran successfully"}
 	results := state.ActionResults{
 		Status:  state.ActionCompleted,
-		Results: output,
+		Results: map[string]interface{}{"output": "action ran successfully"},
+	}
+	if result != nil {
+		results = stateActionResults(result)
+	}
+	if _, err := action.Finish(results); err != nil {
+		return err
+	}
+
+	s.publishTransition("action", action.Id(), "complete", string(results.Status))
+	return nil
+}
+
+// Explicitly complete the action with the given ID in the model with the
+// given UUID (or in the controller model), which must be pending. If the
+// given result is nil, the one registered for the action or the one in the
+// charm descriptor (if any) will be used. This is typically used in manual
+// mode.
+func (s *FakeJujuService) CompleteAction(model, id string, result *params.ActionResult) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, err := s.lookupModelState(model)
+	if err != nil {
+		return err
+	}
+	action, err := st.Action(id)
+	if err != nil {
+		return err
+	}
+	if action.Status() != state.ActionPending {
+		return errors.Errorf("action %s is not pending", id)
+	}
+	if result == nil {
+		result = s.actionResult(st, action)
+	}
+	return s.completeAction(action, result)
+}
+
+// Return a summary of all actions enqueued on the units of the model with
+// the given UUID (or of the controller model).
+func (s *FakeJujuService) Actions(model string) ([]params.Action, error) {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return nil, err
+	}
+	applications, err := st.AllApplications()
+	if err != nil {
+		return nil, err
+	}
+	infos := []params.Action{}
+	for _, application := range applications {
+		units, err := application.AllUnits()
+		if err != nil {
+			return nil, err
+		}
+		for _, unit := range units {
+			actions, err := unit.Actions()
+			if err != nil {
+				return nil, err
+			}
+			for _, action := range actions {
+				infos = append(infos, newActionInfo(action))
+			}
+		}
+	}
+	return infos, nil
+}
+
+func newActionInfo(action state.Action) params.Action {
+	results, message := action.Results()
+	return params.Action{
+		Id:         action.Id(),
+		Name:       action.Name(),
+		Receiver:   action.Receiver(),
+		Parameters: action.Parameters(),
+		Status:     string(action.Status()),
+		Message:    message,
+		Results:    results,
+		Enqueued:   action.Enqueued(),
+		Completed:  action.Completed(),
 	}
-	_, err := action.Finish(results)
-	return err
 }
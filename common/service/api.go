@@ -3,26 +3,77 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bmizerany/pat"
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api/fakejuju/params"
 )
 
 // Start an HTTP server in a goroutine, exposing the control plane API.
 func (f *FakeJujuRunner) serveControlPlaneAPI() error {
 
+	// Endpoints acting on the entities of a model accept a "model" query
+	// parameter with the model UUID, and default to the controller model.
 	mux := pat.New()
 	mux.Post("/bootstrap", http.HandlerFunc(f.bootstrap))
 	mux.Post("/destroy", http.HandlerFunc(f.destroy))
+	mux.Post("/reset", http.HandlerFunc(f.reset))
+	mux.Get("/controller", http.HandlerFunc(f.controllerInfo))
+	mux.Get("/controllers", http.HandlerFunc(f.listControllers))
+	mux.Post("/controllers/:name/bootstrap", http.HandlerFunc(f.bootstrapController))
+	mux.Post("/controllers/:name/destroy", http.HandlerFunc(f.destroyController))
+	mux.Get("/controllers/:name/", http.HandlerFunc(f.forwardToController))
+	mux.Post("/controllers/:name/", http.HandlerFunc(f.forwardToController))
+	mux.Del("/controllers/:name/", http.HandlerFunc(f.forwardToController))
 	mux.Post("/fail/:entity", http.HandlerFunc(f.fail))
+	mux.Del("/fail/:entity", http.HandlerFunc(f.unfail))
+	mux.Del("/failures", http.HandlerFunc(f.clearFailures))
+	mux.Get("/machines", http.HandlerFunc(f.machines))
+	mux.Get("/units", http.HandlerFunc(f.units))
+	mux.Get("/actions", http.HandlerFunc(f.actions))
+	mux.Get("/relations", http.HandlerFunc(f.relations))
+	mux.Get("/relations/:id/units/:unit/settings", http.HandlerFunc(f.relationSettings))
+	mux.Post("/relations/:id/units/:unit/settings", http.HandlerFunc(f.setRelationSettings))
+	mux.Get("/applications/:app/leader", http.HandlerFunc(f.applicationLeader))
+	mux.Post("/applications/:app/leader", http.HandlerFunc(f.setApplicationLeader))
+	mux.Get("/applications/:app/leader-settings", http.HandlerFunc(f.leaderSettings))
+	mux.Post("/applications/:app/leader-settings", http.HandlerFunc(f.setLeaderSettings))
+	mux.Get("/failures", http.HandlerFunc(f.failures))
+	mux.Post("/action-results", http.HandlerFunc(f.setActionResult))
+	mux.Get("/action-results", http.HandlerFunc(f.actionResults))
+	mux.Del("/action-results", http.HandlerFunc(f.clearActionResults))
+	mux.Get("/latencies", http.HandlerFunc(f.latencies))
+	mux.Post("/latencies", http.HandlerFunc(f.setLatencies))
+	mux.Post("/machines/:id/start", http.HandlerFunc(f.startMachine))
+	mux.Post("/units/:unit/start", http.HandlerFunc(f.startUnit))
+	mux.Post("/units/:unit/status", http.HandlerFunc(f.setUnitStatus))
+	mux.Post("/actions/:id/complete", http.HandlerFunc(f.completeAction))
+	mux.Get("/events", http.HandlerFunc(f.events))
+	mux.Post("/wait", http.HandlerFunc(f.wait))
+	mux.Post("/scenario", http.HandlerFunc(f.playScenario))
+	mux.Del("/scenario", http.HandlerFunc(f.stopScenario))
+	mux.Post("/rules", http.HandlerFunc(f.setRules))
+	mux.Del("/rules", http.HandlerFunc(f.clearRules))
 
 	// We want to use a port different than the one used for the
 	// juju API server. Incrementing by one will do the trick and
 	// also make the control-plan port predictable (if the API
-	// server one is known)
+	// server one is known). If the API server port is random, use
+	// a random one as well.
 	port := f.options.Port + 1
+	if f.options.Port == 0 {
+		port = 0
+	}
 
 	var err error
 	f.listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
@@ -32,7 +83,7 @@ func (f *FakeJujuRunner) serveControlPlaneAPI() error {
 	server := &http.Server{Handler: mux}
 
 	go func() {
-		log.Infof("Starting control plane API on port %d", port)
+		log.Infof("Starting control plane API on address %s", f.listener.Addr())
 		server.Serve(f.listener)
 	}()
 
@@ -61,15 +112,536 @@ func (f *FakeJujuRunner) destroy(w http.ResponseWriter, req *http.Request) {
 	writeResponse(w, <-command.done)
 }
 
-// Mark the given entity as doomed to fail
+// Reset a model of the running controller, removing all applications,
+// units, machines and actions, without tearing down the controller.
+func (f *FakeJujuRunner) reset(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	writeResponse(w, service.Reset(req.URL.Query().Get("model")))
+}
+
+// Return the connection information of the bootstrapped controller
+func (f *FakeJujuRunner) controllerInfo(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	writeJSONResponse(w, service.ControllerInfo(), nil)
+}
+
+// List the named controllers hosted by child processes
+func (f *FakeJujuRunner) listControllers(w http.ResponseWriter, req *http.Request) {
+	writeJSONResponse(w, f.Controllers(), nil)
+}
+
+// Bootstrap a named controller, starting a child process to host it if
+// needed.
+func (f *FakeJujuRunner) bootstrapController(w http.ResponseWriter, req *http.Request) {
+	controller, err := f.startController(req.URL.Query().Get(":name"))
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	controller.forward(w, req)
+}
+
+// Destroy a named controller by stopping its child process
+func (f *FakeJujuRunner) destroyController(w http.ResponseWriter, req *http.Request) {
+	writeResponse(w, f.stopController(req.URL.Query().Get(":name")))
+}
+
+// Forward a request to the control plane API of a named controller, for
+// example /controllers/foo/units is the same as /units on the control
+// plane API of the child process hosting controller "foo".
+func (f *FakeJujuRunner) forwardToController(w http.ResponseWriter, req *http.Request) {
+	controller, err := f.getController(req.URL.Query().Get(":name"))
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	controller.forward(w, req)
+}
+
+// Mark the given entity as doomed to fail. The request body can optionally
+// contain a JSON-encoded Failure, describing how the entity should fail.
+// The model can be given either in the body or with the "model" query
+// parameter, and defaults to the controller model. Failures can be set
+// before bootstrap, for example to make the controller machine fail, and
+// are dropped when the controller is destroyed.
 func (f *FakeJujuRunner) fail(w http.ResponseWriter, req *http.Request) {
-	SetFailure(req.URL.Query().Get(":entity"))
+	failure := &params.Failure{}
+	err := json.NewDecoder(req.Body).Decode(failure)
+	if err != nil && err != io.EOF {
+		writeResponse(w, err)
+		return
+	}
+	if err := failure.Validate(); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	if failure.Model == "" {
+		failure.Model = req.URL.Query().Get("model")
+	}
+	failure.Entity = req.URL.Query().Get(":entity")
+	f.getFailures().set(failure)
+	writeResponse(w, nil)
+}
+
+// Remove the failure scheduled for the given entity of the model given by
+// the "model" query parameter (or of the controller model).
+func (f *FakeJujuRunner) unfail(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	model := query.Get("model")
+	entity := query.Get(":entity")
+	if service, err := f.getService(); err == nil {
+		// Let the entity proceed, if it was kept dying.
+		writeResponse(w, service.RemoveFailure(model, entity))
+		return
+	}
+	writeResponse(w, f.getFailures().remove(model, entity))
+}
+
+// Remove all scheduled failures, or only the ones of the model given by
+// the "model" query parameter.
+func (f *FakeJujuRunner) clearFailures(w http.ResponseWriter, req *http.Request) {
+	model := req.URL.Query().Get("model")
+	if service, err := f.getService(); err == nil {
+		// Let the entities proceed, if they were kept dying.
+		writeResponse(w, service.RemoveFailures(model))
+		return
+	}
+	f.getFailures().clear(model)
+	writeResponse(w, nil)
+}
+
+// List the machines in the model
+func (f *FakeJujuRunner) machines(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	machines, err := service.Machines(req.URL.Query().Get("model"))
+	writeJSONResponse(w, machines, err)
+}
+
+// List the units in the model
+func (f *FakeJujuRunner) units(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	units, err := service.Units(req.URL.Query().Get("model"))
+	writeJSONResponse(w, units, err)
+}
+
+// List the actions in the model
+func (f *FakeJujuRunner) actions(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	actions, err := service.Actions(req.URL.Query().Get("model"))
+	writeJSONResponse(w, actions, err)
+}
+
+// List the relations in the model
+func (f *FakeJujuRunner) relations(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	relations, err := service.Relations(req.URL.Query().Get("model"))
+	writeJSONResponse(w, relations, err)
+}
+
+// Return the settings of a unit in a relation
+func (f *FakeJujuRunner) relationSettings(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	id, err := relationId(query.Get(":id"))
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	name := unitName(query.Get(":unit"))
+	settings, err := service.RelationSettings(query.Get("model"), id, name)
+	writeJSONResponse(w, settings, err)
+}
+
+// Set the settings of a unit in a relation. The request body must contain
+// a JSON object with string values, null values delete the setting.
+func (f *FakeJujuRunner) setRelationSettings(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	id, err := relationId(query.Get(":id"))
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	settings := make(map[string]interface{})
+	if err := json.NewDecoder(req.Body).Decode(&settings); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	name := unitName(query.Get(":unit"))
+	writeResponse(w, service.SetRelationSettings(query.Get("model"), id, name, settings))
+}
+
+// Return the unit holding the leadership of an application.
+func (f *FakeJujuRunner) applicationLeader(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	leader, err := service.ApplicationLeader(query.Get("model"), query.Get(":app"))
+	writeJSONResponse(w, params.Leader{Unit: leader}, err)
+}
+
+// Force a leadership change. The request body must contain a JSON object
+// with the name of the new leader unit. The response is sent once the unit
+// holds the leadership, which can take a few seconds.
+func (f *FakeJujuRunner) setApplicationLeader(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	body := params.Leader{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	application, name := query.Get(":app"), unitName(body.Unit)
+	writeResponse(w, service.SetApplicationLeader(query.Get("model"), application, name))
+}
+
+// Return the leader settings of an application
+func (f *FakeJujuRunner) leaderSettings(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	settings, err := service.LeaderSettings(query.Get("model"), query.Get(":app"))
+	writeJSONResponse(w, settings, err)
+}
+
+// Update the leader settings of an application. The request body must
+// contain a JSON object with string values, empty values delete the
+// setting.
+func (f *FakeJujuRunner) setLeaderSettings(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	settings := make(map[string]string)
+	if err := json.NewDecoder(req.Body).Decode(&settings); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	application := query.Get(":app")
+	writeResponse(w, service.SetLeaderSettings(query.Get("model"), application, settings))
+}
+
+// List the entities that are scheduled to fail, in all models or only in
+// the model given by the "model" query parameter.
+func (f *FakeJujuRunner) failures(w http.ResponseWriter, req *http.Request) {
+	writeJSONResponse(w, f.getFailures().list(req.URL.Query().Get("model")), nil)
+}
+
+// Register the result that matching actions should complete with. The
+// request body must contain a JSON-encoded ActionResult. Results can be
+// registered before bootstrap, and are dropped when the controller is
+// destroyed.
+func (f *FakeJujuRunner) setActionResult(w http.ResponseWriter, req *http.Request) {
+	result := &params.ActionResult{}
+	if err := json.NewDecoder(req.Body).Decode(result); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	if err := result.Validate(); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	f.getActionResults().set(result)
+	writeResponse(w, nil)
+}
+
+// List the registered action results
+func (f *FakeJujuRunner) actionResults(w http.ResponseWriter, req *http.Request) {
+	writeJSONResponse(w, f.getActionResults().list(), nil)
+}
+
+// Remove all registered action results
+func (f *FakeJujuRunner) clearActionResults(w http.ResponseWriter, req *http.Request) {
+	f.getActionResults().clear()
+	writeResponse(w, nil)
+}
+
+// Return the current latency settings
+func (f *FakeJujuRunner) latencies(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	writeJSONResponse(w, service.Latencies(), nil)
+}
+
+// Change the latency settings. The request body must contain JSON-encoded
+// Latencies, replacing the current ones.
+func (f *FakeJujuRunner) setLatencies(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	latencies := params.Latencies{}
+	if err := json.NewDecoder(req.Body).Decode(&latencies); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	service.SetLatencies(latencies)
+	writeResponse(w, nil)
+}
+
+// Start playing a scenario, replacing the current one. The request body
+// must contain the scenario in YAML format.
+func (f *FakeJujuRunner) playScenario(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	scenario, err := ParseScenario(data)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	service.PlayScenario(scenario)
+	writeResponse(w, nil)
+}
+
+// Stop playing the current scenario
+func (f *FakeJujuRunner) stopScenario(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	service.StopScenario()
+	writeResponse(w, nil)
+}
+
+// Replace the rules describing how units react to changes. The request
+// body must contain the rules in YAML format.
+func (f *FakeJujuRunner) setRules(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	service.SetRules(rules)
+	writeResponse(w, nil)
+}
+
+// Remove all rules
+func (f *FakeJujuRunner) clearRules(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	service.SetRules(nil)
+	writeResponse(w, nil)
+}
+
+// Start a pending machine
+func (f *FakeJujuRunner) startMachine(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	writeResponse(w, service.StartMachine(query.Get("model"), query.Get(":id")))
+}
+
+// Start an allocating unit. Since unit names contain a slash, the unit is
+// identified using a dash instead (e.g. "mysql-0" for "mysql/0").
+func (f *FakeJujuRunner) startUnit(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	writeResponse(w, service.StartUnit(query.Get("model"), unitName(query.Get(":unit"))))
+}
+
+// Set the agent and/or workload status of a unit.
+func (f *FakeJujuRunner) setUnitStatus(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	body := params.UnitStatusRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	name := unitName(query.Get(":unit"))
+	writeResponse(w, service.SetUnitStatus(query.Get("model"), name, body.Agent, body.Workload))
+}
+
+// Complete a pending action. The request body can optionally contain a
+// JSON-encoded ActionResult, otherwise the registered one will be used.
+func (f *FakeJujuRunner) completeAction(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	result := &params.ActionResult{}
+	err = json.NewDecoder(req.Body).Decode(result)
+	if err == io.EOF {
+		result = nil
+	} else if err == nil {
+		// The action name is implied by the URL, so only the
+		// status needs to be checked.
+		err = result.ValidateStatus()
+	}
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	query := req.URL.Query()
+	writeResponse(w, service.CompleteAction(query.Get("model"), query.Get(":id"), result))
+}
+
+// Stream the events published by the service, using the server-sent
+// events protocol. The stream ends when the controller gets destroyed.
+func (f *FakeJujuRunner) events(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeResponse(w, errors.New("streaming not supported"))
+		return
+	}
+	var closed <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed = notifier.CloseNotify()
+	}
+
+	events := service.Subscribe()
+	defer service.Unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			// Encode a pointer, so that the raw entity JSON is
+			// embedded as is.
+			data, err := json.Marshal(&event)
+			if err != nil {
+				log.Errorf("Can't encode event: %s", err.Error())
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Block until a condition is satisfied. If the timeout expires, the last
+// observed state is returned with "matched" set to false.
+func (f *FakeJujuRunner) wait(w http.ResponseWriter, req *http.Request) {
+	service, err := f.getService()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	body := params.WaitRequest{Timeout: "1m"}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	timeout, err := time.ParseDuration(body.Timeout)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	condition, err := ParseCondition(body.Condition)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	result, err := service.WaitFor(req.URL.Query().Get("model"), condition, timeout)
+	writeJSONResponse(w, result, err)
 }
 
 // Write the response, in case of error the message is provided in the body.
 func writeResponse(w http.ResponseWriter, err error) {
 	var body string
-	if err != nil {
+	if errors.IsNotFound(err) {
+		w.WriteHeader(http.StatusNotFound)
+		body = err.Error()
+	} else if errors.IsAlreadyExists(err) {
+		w.WriteHeader(http.StatusConflict)
+		body = err.Error()
+	} else if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		body = err.Error()
 	} else {
@@ -77,3 +649,38 @@ func writeResponse(w http.ResponseWriter, err error) {
 	}
 	w.Write([]byte(fmt.Sprintf("%s\n", body)))
 }
+
+// Write the given value as JSON body of the response. In case of error
+// the response is the same as the one written by writeResponse.
+func writeJSONResponse(w http.ResponseWriter, value interface{}, err error) {
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// Convert a unit name as used in URLs (e.g. "mysql-0") to a regular unit
+// name (e.g. "mysql/0").
+func unitName(name string) string {
+	i := strings.LastIndex(name, "-")
+	if i == -1 || strings.Contains(name, "/") {
+		return name
+	}
+	return name[:i] + "/" + name[i+1:]
+}
+
+// Convert a relation ID in a URL to an int.
+func relationId(id string) (int, error) {
+	value, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, errors.NotValidf("relation ID %q", id)
+	}
+	return value, nil
+}
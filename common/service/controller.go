@@ -0,0 +1,79 @@
+// Run a fake controller in-process, e.g. from a Go test's TestMain
+
+package service
+
+import (
+	"io/ioutil"
+	"net"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api"
+)
+
+// A fake controller running in the current process.
+type Controller struct {
+	runner *FakeJujuRunner
+
+	// Addresses, CA certificate, admin credentials and model of the
+	// controller, suitable for api.Open().
+	APIInfo *api.Info
+
+	// The port that the control plane API listens to.
+	ControlPlanePort int
+}
+
+// Start a new fake controller in the current process, using the given
+// options. If options.Port is 0, both the juju API server and the control
+// plane API will listen to random free ports. If options.Output is nil,
+// logs are discarded.
+//
+// Only one controller at a time can run in a process, see DESIGN.rst.
+func StartController(options FakeJujuOptions) (*Controller, error) {
+	if options.Output == nil {
+		options.Output = ioutil.Discard
+	}
+	runner := NewFakeJujuRunner(&options)
+	runner.Run()
+
+	// If the service fails to start or bootstrap, the main loop will
+	// terminate and we'll get its result instead of the command's.
+	command := newCommand(commandCodeBootstrap)
+	runner.commands <- command
+	select {
+	case err := <-command.done:
+		if err != nil {
+			runner.Stop()
+			runner.Wait()
+			return nil, errors.Annotate(err, "cannot bootstrap")
+		}
+	case err := <-runner.result:
+		return nil, errors.Annotate(err, "fake-juju service failed to bootstrap")
+	}
+
+	service, err := runner.getService()
+	if err != nil {
+		return nil, err
+	}
+	return &Controller{
+		runner:           runner,
+		APIInfo:          service.APIInfo(),
+		ControlPlanePort: runner.listener.Addr().(*net.TCPAddr).Port,
+	}, nil
+}
+
+// The admin password of the controller.
+func (c *Controller) Password() string {
+	return c.APIInfo.Password
+}
+
+// The CA certificate of the controller, in PEM format.
+func (c *Controller) CACert() string {
+	return c.APIInfo.CACert
+}
+
+// Destroy the controller and stop the fake-juju service.
+func (c *Controller) Close() error {
+	c.runner.Stop()
+	return errors.Annotate(c.runner.Wait(), "fake-juju service finished uncleanly")
+}
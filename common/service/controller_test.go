@@ -0,0 +1,32 @@
+package service_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api"
+
+	"../service"
+)
+
+// StartController runs a fake controller in-process, that can be connected
+// to using the returned API info.
+func (s *FakeJujuRunnerSuite) TestStartController(c *gc.C) {
+	options := *s.options
+	options.Port = 0
+	controller, err := service.StartController(options)
+	if err != nil {
+		c.Log(s.output.String())
+	}
+	c.Assert(err, gc.IsNil)
+	defer func() {
+		c.Assert(controller.Close(), gc.IsNil)
+	}()
+
+	c.Check(controller.CACert(), gc.Not(gc.Equals), "")
+	c.Check(controller.Password(), gc.Not(gc.Equals), "")
+	c.Check(controller.ControlPlanePort, gc.Not(gc.Equals), 0)
+
+	conn, err := api.Open(controller.APIInfo, api.DialOpts{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(conn.Close(), gc.IsNil)
+}
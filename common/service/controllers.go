@@ -0,0 +1,272 @@
+// Host named controllers in child fake-jujud processes
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils"
+
+	"github.com/juju/juju/api/fakejuju/params"
+)
+
+// How long to wait for the control plane API of a child process to come
+// up, and for a child process to exit once asked to.
+const childTimeout = time.Minute
+
+// Valid named controller names, which are used in URLs.
+var validControllerName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// A named controller, hosted by a child fake-jujud process with its own
+// juju API port, MongoDB instance, controller UUID and CA. A single process
+// can't host more than one controller, see DESIGN.rst.
+type namedController struct {
+	name string
+	uuid string
+
+	// The port of the juju API server. The control plane API of the child
+	// listens to the next one.
+	port int
+
+	cmd   *exec.Cmd
+	proxy *httputil.ReverseProxy
+
+	// Closed when the child process exits.
+	exited chan struct{}
+}
+
+// Return the named controller with the given name.
+func (f *FakeJujuRunner) getController(name string) (*namedController, error) {
+	f.controllersMutex.Lock()
+	defer f.controllersMutex.Unlock()
+	controller, ok := f.controllers[name]
+	if !ok {
+		return nil, errors.NotFoundf("controller %s", name)
+	}
+	return controller, nil
+}
+
+// Return a summary of all named controllers, sorted by name.
+func (f *FakeJujuRunner) Controllers() []params.NamedController {
+	f.controllersMutex.Lock()
+	defer f.controllersMutex.Unlock()
+	names := make([]string, 0, len(f.controllers))
+	for name := range f.controllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infos := make([]params.NamedController, len(names))
+	for i, name := range names {
+		controller := f.controllers[name]
+		infos[i] = params.NamedController{
+			Name:             name,
+			ControllerUUID:   controller.uuid,
+			APIPort:          controller.port,
+			ControlPlanePort: controller.port + 1,
+		}
+	}
+	return infos
+}
+
+// Return the named controller with the given name, spawning a child
+// process for it if it's not running yet. The child process inherits the
+// command line options of this one, except for the ports, MongoDB and
+// certificate ones.
+func (f *FakeJujuRunner) startController(name string) (*namedController, error) {
+	if !validControllerName.MatchString(name) {
+		return nil, errors.NotValidf("controller name %q", name)
+	}
+	if len(f.options.ControllerCommand) == 0 {
+		return nil, errors.NotSupportedf("named controllers")
+	}
+
+	// Hold the mutex while the child process starts, so the same
+	// controller doesn't get started twice.
+	f.controllersMutex.Lock()
+	defer f.controllersMutex.Unlock()
+	if controller, ok := f.controllers[name]; ok {
+		return controller, nil
+	}
+
+	uuid, err := utils.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+	port, err := findFreePorts()
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{}, f.options.ControllerCommand[1:]...)
+	args = append(args,
+		"-port", fmt.Sprint(port),
+		"-mongo", "0",
+		"-random-cert",
+		"-controller-uuid", uuid.String(),
+	)
+	cmd := exec.Command(f.options.ControllerCommand[0], args...)
+	cmd.Stdout = f.options.Output
+	cmd.Stderr = f.options.Output
+
+	// Make sure the child doesn't outlive us, should we die abruptly.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+
+	log.Infof("Starting controller %s on port %d", name, port)
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Annotatef(err, "cannot start controller %s", name)
+	}
+	controller := &namedController{
+		name:   name,
+		uuid:   uuid.String(),
+		port:   port,
+		cmd:    cmd,
+		exited: make(chan struct{}),
+	}
+	controller.proxy = &httputil.ReverseProxy{
+		Director:      controller.direct,
+		FlushInterval: 100 * time.Millisecond, // For the events stream
+	}
+	go f.monitorController(controller)
+
+	if err := controller.waitControlPlaneAPI(); err != nil {
+		controller.stop()
+		return nil, errors.Annotatef(err, "cannot start controller %s", name)
+	}
+	f.controllers[name] = controller
+	return controller, nil
+}
+
+// Stop the child process of the named controller with the given name,
+// which will destroy the controller.
+func (f *FakeJujuRunner) stopController(name string) error {
+	f.controllersMutex.Lock()
+	controller, ok := f.controllers[name]
+	delete(f.controllers, name)
+	f.controllersMutex.Unlock()
+	if !ok {
+		return errors.NotFoundf("controller %s", name)
+	}
+	return controller.stop()
+}
+
+// Stop the child processes of all named controllers.
+func (f *FakeJujuRunner) stopControllers() {
+	for _, info := range f.Controllers() {
+		if err := f.stopController(info.Name); err != nil {
+			log.Errorf("Cannot stop controller %s: %s", info.Name, err.Error())
+		}
+	}
+}
+
+// Wait for the child process of a named controller to exit, and forget
+// about the controller.
+func (f *FakeJujuRunner) monitorController(controller *namedController) {
+	err := controller.cmd.Wait()
+	if err != nil {
+		log.Errorf("Controller %s exited: %s", controller.name, err.Error())
+	} else {
+		log.Infof("Controller %s exited", controller.name)
+	}
+	close(controller.exited)
+
+	f.controllersMutex.Lock()
+	defer f.controllersMutex.Unlock()
+	if f.controllers[controller.name] == controller {
+		delete(f.controllers, controller.name)
+	}
+}
+
+// Forward a request to the control plane API of the controller.
+func (c *namedController) forward(w http.ResponseWriter, req *http.Request) {
+	c.proxy.ServeHTTP(w, req)
+}
+
+// Rewrite a request for the control plane API of the controller, stripping
+// the /controllers/:name prefix and the parameters added by the router.
+func (c *namedController) direct(req *http.Request) {
+	req.URL.Scheme = "http"
+	req.URL.Host = fmt.Sprintf("127.0.0.1:%d", c.port+1)
+	req.URL.Path = strings.TrimPrefix(req.URL.Path, "/controllers/"+c.name)
+	query := req.URL.Query()
+	for key := range query {
+		if strings.HasPrefix(key, ":") {
+			query.Del(key)
+		}
+	}
+	req.URL.RawQuery = query.Encode()
+}
+
+// Wait for the control plane API of the child process to accept
+// connections.
+func (c *namedController) waitControlPlaneAPI() error {
+	addr := fmt.Sprintf("127.0.0.1:%d", c.port+1)
+	timeout := time.After(childTimeout)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-c.exited:
+			return errors.New("child process exited")
+		case <-timeout:
+			return errors.Errorf("control plane API not listening on %s", addr)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Terminate the child process and wait for it to exit. The child destroys
+// its controller and MongoDB instance on the way out.
+func (c *namedController) stop() error {
+	log.Infof("Stopping controller %s", c.name)
+	if err := c.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		select {
+		case <-c.exited:
+			return nil // Already gone
+		default:
+			return err
+		}
+	}
+	select {
+	case <-c.exited:
+	case <-time.After(childTimeout):
+		c.cmd.Process.Kill()
+		<-c.exited
+		return errors.Errorf("controller %s didn't stop in time", c.name)
+	}
+	if !c.cmd.ProcessState.Success() {
+		return errors.Errorf("controller %s finished uncleanly", c.name)
+	}
+	return nil
+}
+
+// Find a pair of consecutive free ports on localhost, for the juju API
+// server and the control plane API of a child process.
+func findFreePorts() (int, error) {
+	for i := 0; i < 10; i++ {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		next, err := net.Listen("tcp", fmt.Sprintf(":%d", port+1))
+		listener.Close()
+		if err != nil {
+			continue
+		}
+		next.Close()
+		return port, nil
+	}
+	return 0, errors.New("cannot find free ports")
+}
@@ -0,0 +1,199 @@
+// Load fake behaviour descriptors shipped inside charms
+
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/network"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/state/storage"
+)
+
+// The name of the optional descriptor file, next to metadata.yaml at the
+// root of charm archives.
+const charmDescriptorFile = "fake-juju.yaml"
+
+// Describes how fake-jujud should behave for units of a charm. For
+// example:
+//
+//   workload-version: "9.5"
+//   status:
+//     - workload: {status: maintenance, message: installing}
+//     - after: 2s
+//       workload: {status: active, message: ready}
+//   action-results:
+//     backup: {status: completed, results: {path: /tmp/backup.tgz}}
+//   opened-ports: ["5432/tcp", "8000-8010/tcp"]
+type CharmDescriptor struct {
+
+	// Status changes to apply once a unit is started, after the install
+	// sequence.
+	Status []*StatusStep `yaml:"status,omitempty"`
+
+	// The workload version to set on started units.
+	WorkloadVersion string `yaml:"workload-version,omitempty"`
+
+	// Results of the charm actions, keyed by action name. Results set
+	// through the control plane API take precedence.
+	ActionResults map[string]*params.ActionResult `yaml:"action-results,omitempty"`
+
+	// Port ranges to open on started units, e.g. "80/tcp" or
+	// "8000-8010/udp".
+	OpenedPorts []string `yaml:"opened-ports,omitempty"`
+}
+
+// Parse and validate a YAML charm descriptor.
+func ParseCharmDescriptor(data []byte) (*CharmDescriptor, error) {
+	descriptor := &CharmDescriptor{}
+	if err := yaml.Unmarshal(data, descriptor); err != nil {
+		return nil, errors.Annotate(err, "cannot parse charm descriptor")
+	}
+	if err := validateStatusSteps(descriptor.Status); err != nil {
+		return nil, errors.Annotate(err, "status")
+	}
+	for name, result := range descriptor.ActionResults {
+		if result == nil {
+			result = &params.ActionResult{}
+			descriptor.ActionResults[name] = result
+		}
+		result.Action = name
+		if err := result.ValidateStatus(); err != nil {
+			return nil, errors.Annotatef(err, "action %s", name)
+		}
+		result.Results = normalizeYAMLMap(result.Results)
+	}
+	if _, err := descriptor.portRanges(); err != nil {
+		return nil, err
+	}
+	return descriptor, nil
+}
+
+// The port ranges to open.
+func (d *CharmDescriptor) portRanges() ([]network.PortRange, error) {
+	ranges := make([]network.PortRange, len(d.OpenedPorts))
+	for i, ports := range d.OpenedPorts {
+		portRange, err := network.ParsePortRange(ports)
+		if err != nil {
+			return nil, errors.NotValidf("port range %q", ports)
+		}
+		ranges[i] = portRange
+	}
+	return ranges, nil
+}
+
+// Return the descriptor of the charm of the given unit, or nil if the charm
+// doesn't have one. Descriptors are cached, and problems loading them are
+// logged and otherwise ignored, so that broken descriptors don't stop the
+// service.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) unitCharmDescriptor(st *state.State, unit *state.Unit) *CharmDescriptor {
+	application, err := unit.Application()
+	if err != nil {
+		log.Errorf("Cannot get application of unit %s: %s", unit.Name(), err.Error())
+		return nil
+	}
+	charm, _, err := application.Charm()
+	if err != nil {
+		log.Errorf("Cannot get charm of unit %s: %s", unit.Name(), err.Error())
+		return nil
+	}
+
+	key := fmt.Sprintf("%s:%s", st.ModelUUID(), charm.URL())
+	if descriptor, ok := s.descriptors[key]; ok {
+		return descriptor
+	}
+	descriptor, err := loadCharmDescriptor(st, charm)
+	if err != nil {
+		log.Errorf("Cannot load %s of charm %s: %s", charmDescriptorFile, charm.URL(), err.Error())
+	}
+	s.descriptors[key] = descriptor
+	return descriptor
+}
+
+// Read the descriptor from the archive of the given charm, returning nil if
+// there's no descriptor.
+func loadCharmDescriptor(st *state.State, charm *state.Charm) (*CharmDescriptor, error) {
+	stor := storage.NewStorage(st.ModelUUID(), st.MongoSession())
+	reader, _, err := stor.Get(charm.StoragePath())
+	if errors.IsNotFound(err) {
+		return nil, nil // The charm was not uploaded, e.g. in tests
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range archive.File {
+		if file.Name != charmDescriptorFile {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Using %s of charm %s", charmDescriptorFile, charm.URL())
+		return ParseCharmDescriptor(data)
+	}
+	return nil, nil
+}
+
+// Set the workload version and open the ports of a unit that is being
+// started. The status changes are played by startUnit. Errors are logged
+// and otherwise ignored, so that for example a port conflict between two
+// units on the same machine doesn't stop the service.
+func (s *FakeJujuService) applyCharmDescriptor(unit *state.Unit, descriptor *CharmDescriptor) {
+	if descriptor.WorkloadVersion != "" {
+		if err := unit.SetWorkloadVersion(descriptor.WorkloadVersion); err != nil {
+			log.Errorf("Cannot set workload version of unit %s: %s", unit.Name(), err.Error())
+		}
+	}
+	ranges, _ := descriptor.portRanges() // Validated when loaded
+	for _, portRange := range ranges {
+		err := unit.OpenPorts(portRange.Protocol, portRange.FromPort, portRange.ToPort)
+		if err != nil {
+			log.Errorf("Cannot open ports %s of unit %s: %s", portRange, unit.Name(), err.Error())
+		}
+	}
+}
+
+// Return the result that the given action should complete with: the one
+// registered through the control plane API, if any, otherwise the one in
+// the descriptor of the unit's charm, if any.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) actionResult(st *state.State, action state.Action) *params.ActionResult {
+	if result := s.GetActionResult(action.Receiver(), action.Name()); result != nil {
+		return result
+	}
+	unit, err := st.Unit(action.Receiver())
+	if err != nil {
+		return nil
+	}
+	descriptor := s.unitCharmDescriptor(st, unit)
+	if descriptor == nil {
+		return nil
+	}
+	return descriptor.ActionResults[action.Name()]
+}
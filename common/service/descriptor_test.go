@@ -0,0 +1,124 @@
+package service_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v6-unstable"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	coretesting "github.com/juju/juju/juju/testing"
+	"github.com/juju/juju/network"
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+	"github.com/juju/juju/testing/factory"
+
+	"../service"
+)
+
+// Charm descriptors are parsed from YAML and validated.
+func (s *FakeJujuServiceSuite) TestParseCharmDescriptor(c *gc.C) {
+	descriptor, err := service.ParseCharmDescriptor([]byte(`
+workload-version: "9.5"
+status:
+  - workload: {status: maintenance, message: installing}
+  - after: 2s
+    workload: {status: active, message: ready}
+action-results:
+  backup: {status: failed, message: disk full}
+opened-ports: ["5432/tcp", "8000-8010/udp"]
+`))
+	c.Assert(err, gc.IsNil)
+	c.Check(descriptor.WorkloadVersion, gc.Equals, "9.5")
+	c.Check(descriptor.Status, gc.HasLen, 2)
+	c.Check(descriptor.ActionResults["backup"].Action, gc.Equals, "backup")
+	c.Check(descriptor.ActionResults["backup"].Status, gc.Equals, "failed")
+	c.Check(descriptor.OpenedPorts, gc.DeepEquals, []string{"5432/tcp", "8000-8010/udp"})
+
+	_, err = service.ParseCharmDescriptor([]byte("opened-ports: [http]"))
+	c.Check(err, gc.ErrorMatches, `port range "http" not valid`)
+	_, err = service.ParseCharmDescriptor([]byte("action-results: {backup: {status: running}}"))
+	c.Check(err, gc.ErrorMatches, `action backup: action status "running" not valid`)
+}
+
+// Units of a charm shipping a descriptor get its workload version, opened
+// ports and action results. Problems applying the descriptor, like port
+// conflicts between co-located units, don't stop the service.
+func (s *FakeJujuServiceSuite) TestCharmDescriptor(c *gc.C) {
+	dir := c.MkDir()
+	files := map[string]string{
+		"metadata.yaml": "name: pgsql\nsummary: pgsql\ndescription: pgsql\n",
+		"actions.yaml":  "backup:\n  description: Back up the database\n",
+		"fake-juju.yaml": `
+workload-version: "9.5"
+action-results:
+  backup: {status: completed, results: {path: /tmp/backup.tgz}}
+opened-ports: ["5432/tcp"]
+`,
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		c.Assert(err, gc.IsNil)
+	}
+	ch, err := charm.ReadCharmDir(dir)
+	c.Assert(err, gc.IsNil)
+	curl := charm.MustParseURL("local:quantal/pgsql-1")
+	stateCharm, err := coretesting.AddCharm(s.State, curl, ch)
+	c.Assert(err, gc.IsNil)
+
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "pgsql",
+		Charm: stateCharm,
+	})
+	var units []*state.Unit
+	for i := 0; i < 2; i++ {
+		unit, err := application.AddUnit()
+		c.Assert(err, gc.IsNil)
+		c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+		units = append(units, unit)
+	}
+	s.BackingState.StartSync()
+
+	for _, unit := range units {
+		condition, err := service.ParseCondition("unit " + unit.Name() + " workload=active")
+		c.Assert(err, gc.IsNil)
+		result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+		c.Assert(err, gc.IsNil)
+		c.Assert(result.Matched, gc.Equals, true)
+
+		version, err := unit.WorkloadVersion()
+		c.Assert(err, gc.IsNil)
+		c.Check(version, gc.Equals, "9.5")
+	}
+
+	// Only the first unit could open the port.
+	ports, err := units[0].OpenedPorts()
+	c.Assert(err, gc.IsNil)
+	c.Check(ports, gc.DeepEquals, []network.PortRange{{
+		FromPort: 5432,
+		ToPort:   5432,
+		Protocol: "tcp",
+	}})
+
+	action, err := units[0].AddAction("backup", nil)
+	c.Assert(err, gc.IsNil)
+	s.BackingState.StartSync()
+
+	condition, err := service.ParseCondition("action " + action.Id() + " status=completed")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+	info := params.Action{}
+	c.Assert(result.Decode(&info), gc.IsNil)
+	c.Check(info.Results, gc.DeepEquals, map[string]interface{}{"path": "/tmp/backup.tgz"})
+}
@@ -0,0 +1,116 @@
+// Publish events about what the FakeJujuService sees and does
+
+package service
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state/multiwatcher"
+)
+
+// Maximum number of events buffered for a subscriber. If a subscriber
+// doesn't keep up, further events will be dropped.
+const eventBufferSize = 1024
+
+// Fan out events to subscribers.
+type eventHub struct {
+	mutex       sync.Mutex
+	subscribers map[chan params.Event]bool
+	closed      bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan params.Event]bool)}
+}
+
+// Return a new channel that will be sent all published events. The
+// channel is closed when unsubscribing or when the hub gets closed.
+func (h *eventHub) subscribe() chan params.Event {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	events := make(chan params.Event, eventBufferSize)
+	if h.closed {
+		close(events)
+	} else {
+		h.subscribers[events] = true
+	}
+	return events
+}
+
+// Stop sending events to the given channel, and close it.
+func (h *eventHub) unsubscribe(events chan params.Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.subscribers[events] {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// Send the given event to all subscribers, without blocking.
+func (h *eventHub) publish(event params.Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+			log.Warningf("Dropping %s event for %s-%s", event.Type, event.Kind, event.Id)
+		}
+	}
+}
+
+// Unsubscribe all subscribers.
+func (h *eventHub) close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for events := range h.subscribers {
+		delete(h.subscribers, events)
+		close(events)
+	}
+	h.closed = true
+}
+
+// Subscribe to the events published by the service. The returned channel
+// will be closed when the service stops or Unsubscribe is called.
+func (s *FakeJujuService) Subscribe() chan params.Event {
+	return s.events.subscribe()
+}
+
+// Stop receiving events on the given channel.
+func (s *FakeJujuService) Unsubscribe(events chan params.Event) {
+	s.events.unsubscribe(events)
+}
+
+// Publish an event for the given delta.
+func (s *FakeJujuService) publishDelta(delta multiwatcher.Delta) {
+	entity := delta.Entity.EntityId()
+	data, err := json.Marshal(delta.Entity)
+	if err != nil {
+		log.Errorf("Cannot encode %s-%s: %s", entity.Kind, entity.Id, err.Error())
+		return
+	}
+	s.events.publish(params.Event{
+		Type:    params.EventTypeDelta,
+		Time:    time.Now(),
+		Kind:    entity.Kind,
+		Id:      entity.Id,
+		Removed: delta.Removed,
+		Entity:  data,
+	})
+}
+
+// Publish an event for a transition applied to the given entity.
+func (s *FakeJujuService) publishTransition(kind, id, transition, status string) {
+	s.events.publish(params.Event{
+		Type:       params.EventTypeTransition,
+		Time:       time.Now(),
+		Kind:       kind,
+		Id:         id,
+		Transition: transition,
+		Status:     status,
+	})
+}
@@ -0,0 +1,105 @@
+package service_test
+
+import (
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+	"github.com/juju/juju/testing/factory"
+)
+
+// Subscribers receive both the deltas and the transitions applied by the
+// watch loop.
+func (s *FakeJujuServiceSuite) TestEvents(c *gc.C) {
+	events := s.service.Subscribe()
+	s.service.Start()
+	defer s.service.Stop()
+
+	_, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	s.BackingState.StartSync()
+
+	var delta, transition *params.Event
+	timeout := time.After(jujutesting.LongWait)
+	for delta == nil || transition == nil {
+		select {
+		case event := <-events:
+			if event.Kind != "machine" || event.Id != "0" {
+				continue
+			}
+			if event.Type == params.EventTypeDelta && delta == nil {
+				delta = &event
+			}
+			if event.Type == params.EventTypeTransition {
+				transition = &event
+			}
+		case <-timeout:
+			c.Fatalf("timeout waiting for machine events")
+		}
+	}
+	c.Check(delta.Removed, gc.Equals, false)
+	c.Check(transition.Transition, gc.Equals, "start")
+	c.Check(transition.Status, gc.Equals, "started")
+}
+
+// The "start" transition of a unit is published once it has gone through
+// the whole install sequence.
+func (s *FakeJujuServiceSuite) TestEventsUnitStarted(c *gc.C) {
+	events := s.service.Subscribe()
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.BackingState.StartSync()
+
+	var statuses []string
+	timeout := time.After(jujutesting.LongWait)
+	for {
+		select {
+		case event := <-events:
+			if event.Type != params.EventTypeTransition || event.Id != unit.Name() {
+				continue
+			}
+			statuses = append(statuses, event.Status)
+			if event.Transition != "start" {
+				continue
+			}
+			c.Check(event.Status, gc.Equals, "active")
+			c.Check(statuses[0], gc.Equals, "executing")
+			return
+		case <-timeout:
+			c.Fatalf("timeout waiting for unit events")
+		}
+	}
+}
+
+// Subscribers are notified when the service stops, by closing the channel.
+func (s *FakeJujuServiceSuite) TestEventsClosedOnStop(c *gc.C) {
+	events := s.service.Subscribe()
+	s.service.Start()
+	c.Assert(s.service.Stop(), gc.IsNil)
+
+	for range events {
+	}
+}
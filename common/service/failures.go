@@ -4,26 +4,261 @@ package service
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/state/multiwatcher"
 )
 
-// The given entity will fail as soon as possible.
-func SetFailure(entity string) {
-	failures[entity] = true
+// The status message to use for the given failure, falling back to the
+// given default if neither a message nor a hook were specified.
+func failureMessage(f *params.Failure, defaultMessage string) string {
+	if f.Message != "" {
+		return f.Message
+	}
+	if f.Hook != "" {
+		return fmt.Sprintf("hook failed: %q", f.Hook)
+	}
+	return defaultMessage
+}
+
+// The status data to use for the given failure.
+func failureData(f *params.Failure) map[string]interface{} {
+	data := make(map[string]interface{})
+	if f.Hook != "" {
+		data["hook"] = f.Hook
+	}
+	for key, value := range f.Data {
+		data[key] = value
+	}
+	return data
+}
+
+// The given entity will fail as soon as possible, as described by the
+// given failure details. The entity is looked up in the model with the
+// UUID given by failure.Model, or in the controller model.
+func (s *FakeJujuService) SetFailure(entity string, failure *params.Failure) {
+	failure.Entity = entity
+	failure.Model = s.modelUUID(failure.Model)
+	s.failures.set(failure)
+}
+
+// Remove the scheduled failure for the given entity of the given model
+// (or of the controller model, if the UUID is empty), if any. The entity
+// is then handled again, so that it can proceed if it was kept dying.
+func (s *FakeJujuService) RemoveFailure(model, entity string) error {
+	uuid := s.modelUUID(model)
+	if err := s.failures.remove(uuid, entity); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.handleFailedEntity(uuid, entity)
+}
+
+// Remove all scheduled failures, or only the ones of the model with the
+// given UUID if not empty. Like with RemoveFailure, the affected entities
+// are then handled again.
+func (s *FakeJujuService) RemoveFailures(model string) error {
+	failures := s.failures.clear(model)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, failure := range failures {
+		if err := s.handleFailedEntity(failure.Model, failure.Entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handle again the given entity of the model with the given UUID, whose
+// failure was removed.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) handleFailedEntity(uuid, entity string) error {
+	tag, err := names.ParseTag(entity)
+	if err != nil {
+		return nil // Not an entity that we handle
+	}
+	return s.handleEntityChanged(multiwatcher.EntityId{
+		Kind:      tag.Kind(),
+		ModelUUID: uuid,
+		Id:        tag.Id(),
+	})
+}
+
+// Whether the given entity of the given model (or of the controller model,
+// if the UUID is empty) should fail.
+func (s *FakeJujuService) ShouldFail(model, kind, id string) bool {
+	return s.failures.get(s.modelUUID(model), kind, id) != nil
+}
+
+// Return the failures that are currently scheduled, in all models.
+func (s *FakeJujuService) Failures() []*params.Failure {
+	return s.failures.list("")
+}
+
+// Return the failures that are currently scheduled in the given model.
+func (s *FakeJujuService) ModelFailures(model string) []*params.Failure {
+	return s.failures.list(s.modelUUID(model))
+}
+
+// Clear all scheduled failures, in all models.
+func (s *FakeJujuService) ClearFailures() {
+	s.failures.clear("")
+}
+
+// Clear the failures scheduled in the given model.
+func (s *FakeJujuService) ClearModelFailures(model string) {
+	s.failures.clear(s.modelUUID(model))
 }
 
-// Whether the given entity should fail
-func ShouldFail(kind, id string) bool {
+// Return the failure details for the given entity of the given State's
+// model, or nil if the entity is not scheduled to fail.
+func (s *FakeJujuService) getFailure(st *state.State, kind, id string) *params.Failure {
+	return s.failures.get(st.ModelUUID(), kind, id)
+}
+
+// Return the given model UUID, or the controller model one if empty.
+func (s *FakeJujuService) modelUUID(uuid string) string {
+	if uuid == "" {
+		return s.state.ModelUUID()
+	}
+	return uuid
+}
+
+// Scheduled failures, keyed by model UUID and entity. It's written by
+// control plane API handlers and read by watch loops, so it has its own
+// lock rather than relying on the service one.
+//
+// Failures can be registered before bootstrap, when the UUID of the
+// controller model is not known yet. For this reason the failures of the
+// controller model are keyed with an empty UUID.
+type failureRegistry struct {
+	mutex    sync.Mutex
+	failures map[failureKey]*params.Failure
+
+	// The UUID of the controller model, set at bootstrap.
+	controllerModel string
+}
+
+type failureKey struct {
+	model  string
+	entity string
+}
+
+func newFailureRegistry() *failureRegistry {
+	return &failureRegistry{failures: make(map[failureKey]*params.Failure)}
+}
+
+// Set the UUID of the controller model, which failures registered with an
+// empty model UUID apply to.
+func (r *failureRegistry) setControllerModel(uuid string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.controllerModel = uuid
+}
+
+// Register a failure. A copy is stored, so the caller is free to modify
+// the given one afterwards.
+func (r *failureRegistry) set(failure *params.Failure) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stored := *failure
+	r.failures[r.key(failure.Model, failure.Entity)] = &stored
+}
+
+func (r *failureRegistry) remove(model, entity string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	key := r.key(model, entity)
+	if _, ok := r.failures[key]; !ok {
+		return errors.NotFoundf("failure for %s", entity)
+	}
+	delete(r.failures, key)
+	return nil
+}
+
+// Return a copy of the failure for the given entity, or nil.
+func (r *failureRegistry) get(model, kind, id string) *params.Failure {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	id = strings.Replace(id, "/", "-", -1)
-	_, ok := failures[fmt.Sprintf("%s-%s", kind, id)]
-	return ok
+	failure, ok := r.failures[r.key(model, fmt.Sprintf("%s-%s", kind, id))]
+	if !ok {
+		return nil
+	}
+	return r.copy(failure)
+}
+
+// Return copies of the failures in the given model (or in all models, if
+// the UUID is empty), sorted by model and entity.
+func (r *failureRegistry) list(model string) []*params.Failure {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := make([]*params.Failure, 0, len(r.failures))
+	for key, failure := range r.failures {
+		if model != "" && key != r.key(model, key.entity) {
+			continue
+		}
+		result = append(result, r.copy(failure))
+	}
+	sort.Sort(byModelAndEntity(result))
+	return result
 }
 
-// Clear all scheduled failures
-func ClearFailures() {
-	for key := range failures {
-		delete(failures, key)
+// Remove the failures in the given model (or in all models, if the UUID
+// is empty), returning copies of them.
+func (r *failureRegistry) clear(model string) []*params.Failure {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var removed []*params.Failure
+	for key, failure := range r.failures {
+		if model == "" || key == r.key(model, key.entity) {
+			removed = append(removed, r.copy(failure))
+			delete(r.failures, key)
+		}
 	}
+	return removed
 }
 
-var failures = make(map[string]bool)
+// Return the key for the given entity of the model with the given UUID.
+//
+// This method must be called with the registry mutex held.
+func (r *failureRegistry) key(model, entity string) failureKey {
+	if model == r.controllerModel {
+		model = ""
+	}
+	return failureKey{model, entity}
+}
+
+// Return a copy of the given stored failure, filling in the UUID of the
+// controller model if the failure has none.
+//
+// This method must be called with the registry mutex held.
+func (r *failureRegistry) copy(failure *params.Failure) *params.Failure {
+	result := *failure
+	if result.Model == "" {
+		result.Model = r.controllerModel
+	}
+	return &result
+}
+
+type byModelAndEntity []*params.Failure
+
+func (f byModelAndEntity) Len() int      { return len(f) }
+func (f byModelAndEntity) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f byModelAndEntity) Less(i, j int) bool {
+	if f[i].Model != f[j].Model {
+		return f[i].Model < f[j].Model
+	}
+	return f[i].Entity < f[j].Entity
+}
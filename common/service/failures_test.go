@@ -0,0 +1,68 @@
+package service_test
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+)
+
+// Failures can be listed and removed at runtime.
+func (s *FakeJujuServiceSuite) TestFailuresListAndRemove(c *gc.C) {
+	s.service.SetFailure("unit-mysql-0", &params.Failure{Hook: "install"})
+	s.service.SetFailure("machine-1", &params.Failure{})
+
+	failures := s.service.Failures()
+	c.Assert(failures, gc.HasLen, 2)
+	c.Check(failures[0].Entity, gc.Equals, "machine-1")
+	c.Check(failures[0].Model, gc.Equals, s.State.ModelUUID())
+	c.Check(failures[1].Entity, gc.Equals, "unit-mysql-0")
+	c.Check(failures[1].Hook, gc.Equals, "install")
+	c.Check(s.service.ShouldFail("", "unit", "mysql/0"), gc.Equals, true)
+
+	c.Assert(s.service.RemoveFailure("", "unit-mysql-0"), gc.IsNil)
+	c.Check(s.service.ShouldFail("", "unit", "mysql/0"), gc.Equals, false)
+	c.Check(s.service.Failures(), gc.HasLen, 1)
+}
+
+// Removing a failure that was never set is an error.
+func (s *FakeJujuServiceSuite) TestFailuresRemoveNotFound(c *gc.C) {
+	err := s.service.RemoveFailure("", "unit-mysql-0")
+	c.Assert(errors.IsNotFound(err), gc.Equals, true)
+}
+
+// Failures are scoped to models, so the same entity can fail in one model
+// and not in another.
+func (s *FakeJujuServiceSuite) TestFailuresPerModel(c *gc.C) {
+	other := "deadbeef-0bad-400d-8000-4b1d0d06f00d"
+	s.service.SetFailure("machine-1", &params.Failure{Model: other})
+
+	c.Check(s.service.ShouldFail(other, "machine", "1"), gc.Equals, true)
+	c.Check(s.service.ShouldFail("", "machine", "1"), gc.Equals, false)
+	c.Check(s.service.ModelFailures(""), gc.HasLen, 0)
+	c.Check(s.service.ModelFailures(other), gc.HasLen, 1)
+
+	s.service.SetFailure("machine-1", &params.Failure{})
+	s.service.ClearModelFailures(other)
+	c.Check(s.service.ShouldFail(other, "machine", "1"), gc.Equals, false)
+	c.Check(s.service.ShouldFail("", "machine", "1"), gc.Equals, true)
+}
+
+// The failures registry can be used concurrently.
+func (s *FakeJujuServiceSuite) TestFailuresConcurrentAccess(c *gc.C) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.service.SetFailure("machine-1", &params.Failure{})
+			s.service.ShouldFail("", "machine", "1")
+			s.service.Failures()
+			s.service.ClearFailures()
+		}()
+	}
+	wg.Wait()
+	c.Check(s.service.Failures(), gc.HasLen, 0)
+}
@@ -0,0 +1,74 @@
+// The status changes that units go through when they get started
+
+package service
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/status"
+)
+
+// Return the sequence of status changes that a real unit goes through when
+// its charm gets installed and started, waiting the given delay between
+// hooks:
+//
+//   agent executing "running install hook", workload maintenance
+//   agent executing "running config-changed hook"
+//   agent executing "running start hook"
+//   agent idle, workload active
+func DefaultInstallSequence(delay time.Duration) []*StatusStep {
+	after := ""
+	if delay > 0 {
+		after = delay.String()
+	}
+	return []*StatusStep{{
+		Agent:    &params.Status{Status: string(status.Executing), Message: "running install hook"},
+		Workload: &params.Status{Status: string(status.Maintenance), Message: "installing charm software"},
+	}, {
+		After: after,
+		Agent: &params.Status{Status: string(status.Executing), Message: "running config-changed hook"},
+	}, {
+		After: after,
+		Agent: &params.Status{Status: string(status.Executing), Message: "running start hook"},
+	}, {
+		After:    after,
+		Agent:    &params.Status{Status: string(status.Idle)},
+		Workload: &params.Status{Status: string(status.Active)},
+	}}
+}
+
+// Parse and validate a YAML install sequence, i.e. a list of status steps.
+func ParseInstallSequence(data []byte) ([]*StatusStep, error) {
+	var steps []*StatusStep
+	if err := yaml.Unmarshal(data, &steps); err != nil {
+		return nil, errors.Annotate(err, "cannot parse install sequence")
+	}
+	if err := validateInstallSequence(steps); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// Check that the install sequence is well-formed. The first step must take
+// the unit agent out of the allocating state right away, since that's what
+// tells fake-jujud that the unit was started.
+func validateInstallSequence(steps []*StatusStep) error {
+	if err := validateStatusSteps(steps); err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		return errors.NotValidf("empty install sequence")
+	}
+	first := steps[0]
+	if delay, _ := first.delay(); delay > 0 {
+		return errors.NotValidf("delay of first install step")
+	}
+	if first.Agent == nil || status.Status(first.Agent.Status) == status.Allocating {
+		return errors.NotValidf("first install step without agent status")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package service_test
+
+import (
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+	"github.com/juju/juju/testing/factory"
+
+	"../service"
+)
+
+// Install sequences are parsed from YAML and validated.
+func (s *FakeJujuServiceSuite) TestParseInstallSequence(c *gc.C) {
+	steps, err := service.ParseInstallSequence([]byte(`
+- agent: {status: executing, message: running install hook}
+- after: 1s
+  agent: {status: idle}
+  workload: {status: unknown}
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(steps, gc.HasLen, 2)
+	c.Check(steps[1].Workload.Status, gc.Equals, "unknown")
+
+	_, err = service.ParseInstallSequence([]byte("[{after: 1s, agent: {status: idle}}]"))
+	c.Check(err, gc.ErrorMatches, `delay of first install step not valid`)
+	_, err = service.ParseInstallSequence([]byte("[{workload: {status: active}}]"))
+	c.Check(err, gc.ErrorMatches, `first install step without agent status not valid`)
+}
+
+// Units go through the install sequence when started.
+func (s *FakeJujuServiceSuite) TestWatchLoopInstallSequence(c *gc.C) {
+	options := &service.FakeJujuOptions{
+		Mongo:             -1,
+		Series:            "xenial",
+		AutoStartMachines: true,
+		InstallSequence:   service.DefaultInstallSequence(500 * time.Millisecond),
+	}
+	s.service = service.NewFakeJujuService(s.BackingState, s.APIState, options)
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.BackingState.StartSync()
+
+	for _, text := range []string{
+		"unit mysql/0 agent=executing workload=maintenance",
+		"unit mysql/0 agent=idle workload=active",
+	} {
+		condition, err := service.ParseCondition(text)
+		c.Assert(err, gc.IsNil)
+		result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+		c.Assert(err, gc.IsNil)
+		c.Assert(result.Matched, gc.Equals, true, gc.Commentf(text))
+	}
+}
+
+// An empty install sequence means the default one.
+func (s *FakeJujuServiceSuite) TestWatchLoopEmptyInstallSequence(c *gc.C) {
+	options := &service.FakeJujuOptions{
+		Mongo:             -1,
+		Series:            "xenial",
+		AutoStartMachines: true,
+		InstallSequence:   []*service.StatusStep{},
+	}
+	s.service = service.NewFakeJujuService(s.BackingState, s.APIState, options)
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.BackingState.StartSync()
+
+	condition, err := service.ParseCondition("unit mysql/0 agent=idle workload=active")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+}
@@ -0,0 +1,90 @@
+// Delay entity transitions, to mimic the latencies of real clouds
+
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/state/multiwatcher"
+)
+
+// Return the delay to apply for the given latency, including a random
+// jitter.
+func latencyDuration(l params.Latency) time.Duration {
+	delay := l.Delay
+	if l.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(l.Jitter)))
+	}
+	return delay
+}
+
+// Whether the given latency has no delay at all.
+func isZeroLatency(l params.Latency) bool {
+	return l.Delay == 0 && l.Jitter == 0
+}
+
+// Return the latency for units of the given application.
+func unitLatency(l params.Latencies, application string) params.Latency {
+	if latency, ok := l.Applications[application]; ok {
+		return latency
+	}
+	return l.Unit
+}
+
+// Return the current latency settings.
+func (s *FakeJujuService) Latencies() params.Latencies {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.latencies
+}
+
+// Change the latency settings. Transitions that are already scheduled
+// are not affected.
+func (s *FakeJujuService) SetLatencies(latencies params.Latencies) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.latencies = latencies
+}
+
+// Whether the given transition (e.g. "start" or "remove") of the given
+// entity in the model of the given state is due. If the latency is zero
+// it's always due, otherwise a timer is started and the entity will be
+// handled again once the timer fires, at which point the transition will be
+// due. Each transition has its own timer, so that for example removing an
+// entity while its start is delayed still waits for the removal latency.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) isDue(st *state.State, transition, kind, id string, latency params.Latency) bool {
+	if isZeroLatency(latency) {
+		return true
+	}
+	entity := multiwatcher.EntityId{Kind: kind, ModelUUID: st.ModelUUID(), Id: id}
+	key := fmt.Sprintf("%s:%s-%s:%s", entity.ModelUUID, kind, id, transition)
+	if due, ok := s.timers[key]; ok {
+		if due {
+			delete(s.timers, key)
+		}
+		return due
+	}
+
+	delay := latencyDuration(latency)
+	log.Infof("Delaying transition of %s by %s", key, delay)
+
+	s.timers[key] = false
+	time.AfterFunc(delay, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.stopped {
+			return
+		}
+		s.timers[key] = true
+		if err := s.handleEntityChanged(entity); err != nil {
+			log.Errorf("Delayed transition error: %s (%s)", err.Error(), key)
+		}
+	})
+	return false
+}
@@ -0,0 +1,53 @@
+package service_test
+
+import (
+	"encoding/json"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/status"
+
+	"../service"
+)
+
+// Latencies are encoded in JSON using duration strings.
+func (s *FakeJujuServiceSuite) TestLatenciesJSON(c *gc.C) {
+	data := []byte(`{"machine": {"delay": "2s", "jitter": "500ms"}, "applications": {"mysql": {"delay": "1m"}}}`)
+	latencies := params.Latencies{}
+	c.Assert(json.Unmarshal(data, &latencies), gc.IsNil)
+	c.Check(latencies.Machine.Delay, gc.Equals, 2*time.Second)
+	c.Check(latencies.Machine.Jitter, gc.Equals, 500*time.Millisecond)
+	c.Check(latencies.Unit.Delay, gc.Equals, time.Duration(0))
+	c.Check(latencies.Applications["mysql"].Delay, gc.Equals, time.Minute)
+}
+
+// Pending machines are started only after the configured latency.
+func (s *FakeJujuServiceSuite) TestWatchLoopMachineLatency(c *gc.C) {
+	s.service.SetLatencies(params.Latencies{
+		Machine: params.Latency{Delay: service.MediumWait},
+	})
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+
+	// The machine is still pending right after being added.
+	s.BackingState.StartSync()
+	machineStatus, err := machine.Status()
+	c.Assert(err, gc.IsNil)
+	c.Check(machineStatus.Status, gc.Equals, status.Pending)
+
+	// It eventually gets started.
+	err = machine.WaitAgentPresence(2 * service.MediumWait)
+	c.Assert(err, gc.IsNil)
+	machineStatus, err = machine.Status()
+	c.Assert(err, gc.IsNil)
+	c.Check(machineStatus.Status, gc.Equals, status.Started)
+}
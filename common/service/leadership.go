@@ -0,0 +1,250 @@
+// Elect and track application leaders
+
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/core/leadership"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/status"
+)
+
+// How long leadership leases last. Leaders renew their lease every
+// leadershipRenewal, like the agents of real units do, so a new leader
+// forced through the control plane API can only take over once the lease
+// of the current one expires, within leadershipDuration.
+const (
+	leadershipDuration = 5 * time.Second
+	leadershipRenewal  = time.Second
+)
+
+// Make the given unit the leader of its application, unless the
+// application already has one.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) electLeader(st *state.State, unit *state.Unit) {
+	key := leaderKey(st, unit.ApplicationName())
+	if _, ok := s.leaders[key]; ok {
+		return
+	}
+	log.Infof("Electing unit %s as leader", unit.Name())
+	s.leaders[key] = unit.Name()
+	s.claimLeadership(st, unit.ApplicationName(), unit.Name())
+}
+
+// Handle a removed unit in the model of the given state, electing a new
+// leader among the started units of its application if it was the leader.
+func (s *FakeJujuService) handleUnitRemoved(st *state.State, name string) error {
+	applicationName := strings.Split(name, "/")[0]
+	key := leaderKey(st, applicationName)
+	if s.leaders[key] != name {
+		return nil
+	}
+	delete(s.leaders, key)
+
+	application, err := st.Application(applicationName)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	units, err := application.AllUnits()
+	if err != nil {
+		return err
+	}
+	for _, unit := range units {
+		if unit.Life() != state.Alive {
+			continue
+		}
+		agentStatus, err := unit.AgentStatus()
+		if err != nil {
+			return err
+		}
+		if agentStatus.Status != status.Allocating {
+			s.electLeader(st, unit)
+			break
+		}
+	}
+	return nil
+}
+
+// Claim or renew the leadership lease of the given unit. A denied claim
+// means that the lease of the previous leader hasn't expired yet, it will
+// be retried at the next renewal.
+func (s *FakeJujuService) claimLeadership(st *state.State, application, name string) {
+	err := st.LeadershipClaimer().ClaimLeadership(application, name, leadershipDuration)
+	if err == leadership.ErrClaimDenied {
+		log.Infof("Leadership of %s not yet available for unit %s", application, name)
+	} else if err != nil {
+		log.Errorf("Cannot claim leadership of %s for unit %s: %s", application, name, err.Error())
+	}
+}
+
+// Renew the leadership leases periodically, until the service gets
+// stopped.
+func (s *FakeJujuService) renewLeadership() {
+	ticker := time.NewTicker(leadershipRenewal)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.lock.Lock()
+		if s.stopped {
+			s.lock.Unlock()
+			return
+		}
+		for key, name := range s.leaders {
+			parts := strings.SplitN(key, ":", 2)
+			st := s.modelState(parts[0])
+			if st == nil {
+				delete(s.leaders, key) // The model is gone
+				continue
+			}
+			s.claimLeadership(st, parts[1], name)
+		}
+		s.lock.Unlock()
+	}
+}
+
+// Forget the leaders of the applications in the model with the given UUID.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) clearLeaders(uuid string) {
+	for key := range s.leaders {
+		if strings.HasPrefix(key, uuid+":") {
+			delete(s.leaders, key)
+		}
+	}
+}
+
+// The key of the leader of the given application.
+func leaderKey(st *state.State, application string) string {
+	return fmt.Sprintf("%s:%s", st.ModelUUID(), application)
+}
+
+// Return the name of the unit currently holding the leadership of the given
+// application in the model with the given UUID (or in the controller model),
+// or an empty string if there's none.
+func (s *FakeJujuService) ApplicationLeader(model, application string) (string, error) {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return "", err
+	}
+	return applicationLeader(st, application)
+}
+
+// Return the name of the unit currently holding the leadership of the given
+// application in the model of the given state.
+func applicationLeader(st *state.State, application string) (string, error) {
+	if _, err := st.Application(application); err != nil {
+		return "", err
+	}
+	leaders, err := st.ApplicationLeaders()
+	if err != nil {
+		return "", err
+	}
+	return leaders[application], nil
+}
+
+// Make the unit with the given name the leader of the given application,
+// in the model with the given UUID (or in the controller model). This
+// blocks until the unit holds the leadership, which happens once the lease
+// of the current leader expires.
+func (s *FakeJujuService) SetApplicationLeader(model, application, name string) error {
+	st, err := s.setLeader(model, application, name)
+	if err != nil {
+		return err
+	}
+
+	// Wait for the lease of the current leader to be released without
+	// holding the service lock, since it can take up to
+	// leadershipDuration.
+	claimer := st.LeadershipClaimer()
+	for {
+		if !s.isLeader(st, application, name) {
+			return errors.Errorf("leadership of %s moved to another unit", application)
+		}
+		err := claimer.ClaimLeadership(application, name, leadershipDuration)
+		if err != leadership.ErrClaimDenied {
+			return err
+		}
+		log.Infof("Waiting for leadership of %s to be released", application)
+		if err := claimer.BlockUntilLeadershipReleased(application); err != nil {
+			return err
+		}
+	}
+}
+
+// Record the unit with the given name as leader of the given application,
+// in the model with the given UUID (or in the controller model), so that
+// it's the one claiming the leadership from now on. Return the state of
+// the model.
+func (s *FakeJujuService) setLeader(model, application, name string) (*state.State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, err := s.lookupModelState(model)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := st.Unit(name)
+	if err != nil {
+		return nil, err
+	}
+	if unit.ApplicationName() != application {
+		return nil, errors.NotValidf("unit %s of application %s", name, application)
+	}
+	log.Infof("Setting unit %s as leader", name)
+	s.leaders[leaderKey(st, application)] = name
+	return st, nil
+}
+
+// Whether the unit with the given name is the one claiming the leadership
+// of the given application, in the model of the given state.
+func (s *FakeJujuService) isLeader(st *state.State, application, name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.leaders[leaderKey(st, application)] == name
+}
+
+// Return the leader settings of the given application, in the model with
+// the given UUID (or in the controller model).
+func (s *FakeJujuService) LeaderSettings(model, application string) (map[string]string, error) {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return nil, err
+	}
+	app, err := st.Application(application)
+	if err != nil {
+		return nil, err
+	}
+	return app.LeaderSettings()
+}
+
+// Update the leader settings of the given application, in the model with
+// the given UUID (or in the controller model), on behalf of its leader.
+// Keys with an empty value are deleted.
+func (s *FakeJujuService) SetLeaderSettings(model, application string, settings map[string]string) error {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return err
+	}
+	app, err := st.Application(application)
+	if err != nil {
+		return err
+	}
+	leader, err := applicationLeader(st, application)
+	if err != nil {
+		return err
+	}
+	if leader == "" {
+		return errors.NotFoundf("leader of application %s", application)
+	}
+	log.Infof("Setting leader settings of %s", application)
+	token := st.LeadershipChecker().LeadershipCheck(application, leader)
+	return app.UpdateLeaderSettings(token, settings)
+}
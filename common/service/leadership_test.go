@@ -0,0 +1,64 @@
+package service_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+	"github.com/juju/juju/testing/factory"
+)
+
+// The first started unit of an application is elected as leader, and
+// leadership can be moved to another unit.
+func (s *FakeJujuServiceSuite) TestWatchLoopLeadership(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	for i := 0; i < 2; i++ {
+		unit, err := application.AddUnit()
+		c.Assert(err, gc.IsNil)
+		c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	}
+	s.BackingState.StartSync()
+	s.waitLeader(c, "mysql", "mysql/0")
+
+	// The new leader holds the leadership as soon as the call returns.
+	c.Assert(s.service.SetApplicationLeader("", "mysql", "mysql/1"), gc.IsNil)
+	leader, err := s.service.ApplicationLeader("", "mysql")
+	c.Assert(err, gc.IsNil)
+	c.Check(leader, gc.Equals, "mysql/1")
+
+	err = s.service.SetLeaderSettings("", "mysql", map[string]string{"password": "secret"})
+	c.Assert(err, gc.IsNil)
+	settings, err := s.service.LeaderSettings("", "mysql")
+	c.Assert(err, gc.IsNil)
+	c.Check(settings, gc.DeepEquals, map[string]string{"password": "secret"})
+
+	err = s.service.SetApplicationLeader("", "wordpress", "mysql/0")
+	c.Check(err, gc.ErrorMatches, `unit mysql/0 of application wordpress not valid`)
+}
+
+// Wait for the given unit to hold the leadership of the given application.
+func (s *FakeJujuServiceSuite) waitLeader(c *gc.C, application, name string) {
+	for a := jujutesting.LongAttempt.Start(); a.Next(); {
+		leader, err := s.service.ApplicationLeader("", application)
+		c.Assert(err, gc.IsNil)
+		if leader == name {
+			return
+		}
+	}
+	c.Fatalf("unit %s didn't become leader of %s", name, application)
+}
@@ -0,0 +1,173 @@
+// Set up and tear down fake controllers, without exposing gocheck
+
+package service
+
+import (
+	"io/ioutil"
+
+	"github.com/juju/errors"
+	gc "gopkg.in/check.v1"
+)
+
+// Set up and tear down a controller backed by the dummy provider, reporting
+// problems as regular errors.
+//
+// The actual setup and teardown logic lives in FakeJujuSuite, which builds
+// upon JujuConnSuite and hence needs a *gc.C. To provide it, a private
+// gocheck test is run in the background, executing the lifecycle steps on
+// behalf of ControllerLifecycle and turning failed assertions and panics
+// into errors. A failed assertion terminates the background test, after
+// which all further steps fail.
+type ControllerLifecycle struct {
+	suite *FakeJujuSuite
+
+	// Steps to be executed by the background gocheck test, and a channel
+	// that gets closed when such test terminates.
+	steps  chan *lifecycleStep
+	exited chan struct{}
+
+	bootstrapped bool
+}
+
+func NewControllerLifecycle(options *FakeJujuOptions) *ControllerLifecycle {
+	return &ControllerLifecycle{
+		suite:  &FakeJujuSuite{options: options},
+		steps:  make(chan *lifecycleStep),
+		exited: make(chan struct{}),
+	}
+}
+
+// Perform one-time setup tasks. This must be called before any other
+// method.
+func (l *ControllerLifecycle) SetUp() error {
+	go func() {
+		conf := &gc.RunConf{
+			Output: ioutil.Discard, // Failures are reported as errors
+			Filter: "TestLifecycle",
+		}
+		gc.Run(&lifecycleHost{steps: l.steps}, conf)
+		close(l.exited)
+	}()
+	return l.step("set up", l.suite.SetUpSuite)
+}
+
+// Bootstrap a new controller, and start its FakeJujuService. If the
+// controller is already bootstrapped, an AlreadyExists error is returned
+// and the controller is left alone. If the controller machine is scheduled
+// to fail, the new controller is torn down and a NotProvisioned error is
+// returned. Any other error means that the controller is in an unknown
+// state.
+func (l *ControllerLifecycle) Bootstrap() error {
+	return l.bootstrap(newFailureRegistry(), newActionResultRegistry())
+}
+
+// Bootstrap a new controller like Bootstrap, handing the given failures
+// and action results over to its FakeJujuService.
+func (l *ControllerLifecycle) bootstrap(failures *failureRegistry, actionResults *actionResultRegistry) error {
+	if l.bootstrapped {
+		return errors.NewAlreadyExists(nil, "controller already bootstrapped")
+	}
+	var err error
+	bootstrap := func(c *gc.C) {
+		err = l.suite.bootstrap(c, failures, actionResults)
+	}
+	if stepErr := l.step("bootstrap", bootstrap); stepErr != nil {
+		return stepErr
+	}
+	if err != nil {
+		return err
+	}
+	l.bootstrapped = true
+	return nil
+}
+
+// Destroy the controller, stopping its FakeJujuService and the API server,
+// and resetting the database. If there's no controller, a NotFound error
+// is returned.
+func (l *ControllerLifecycle) Destroy() error {
+	if !l.bootstrapped {
+		return errors.NewNotFound(nil, "controller not bootstrapped")
+	}
+	l.bootstrapped = false
+	return l.step("destroy", l.suite.TearDownTest)
+}
+
+// Destroy the controller (if bootstrapped) and perform final cleanups.
+func (l *ControllerLifecycle) TearDown() error {
+	var err error
+	if l.bootstrapped {
+		err = l.Destroy()
+	}
+	if tearDownErr := l.step("tear down", l.suite.TearDownSuite); err == nil {
+		err = tearDownErr
+	}
+	close(l.steps)
+	<-l.exited
+	return err
+}
+
+// Return the FakeJujuService of the bootstrapped controller, or nil if
+// there's no controller.
+func (l *ControllerLifecycle) Service() *FakeJujuService {
+	if !l.bootstrapped {
+		return nil
+	}
+	return l.suite.service
+}
+
+// Execute a step in the background gocheck test, and wait for its outcome.
+func (l *ControllerLifecycle) step(name string, run func(c *gc.C)) error {
+	step := &lifecycleStep{
+		name: name,
+		run:  run,
+		done: make(chan error, 1),
+	}
+	select {
+	case l.steps <- step:
+	case <-l.exited:
+		return errors.Errorf("cannot %s: controller lifecycle terminated", name)
+	}
+	return <-step.done
+}
+
+// A lifecycle step, i.e. a FakeJujuSuite method.
+type lifecycleStep struct {
+	name string
+	run  func(c *gc.C)
+
+	// Will be sent nil if the step completed, or an error otherwise
+	done chan error
+}
+
+// The gocheck "suite" hosting the background test that executes lifecycle
+// steps.
+type lifecycleHost struct {
+	steps chan *lifecycleStep
+}
+
+// Execute lifecycle steps until the steps channel gets closed. It's prefixed
+// with "Test" only because we need to convince the gocheck package that this
+// is a test method, and thus have it invoked with a *gc.C.
+func (h *lifecycleHost) TestLifecycle(c *gc.C) {
+	for step := range h.steps {
+		h.run(c, step)
+	}
+}
+
+// Execute a single step. If an assertion fails, gocheck will call
+// runtime.Goexit(), but deferred functions still run, so the failure gets
+// reported to the step's channel.
+func (h *lifecycleHost) run(c *gc.C, step *lifecycleStep) {
+	completed := false
+	defer func() {
+		var err error
+		if r := recover(); r != nil {
+			err = errors.Errorf("%s panicked: %v", step.name, r)
+		} else if !completed {
+			err = errors.Errorf("%s failed:\n%s", step.name, c.GetTestLog())
+		}
+		step.done <- err
+	}()
+	step.run(c)
+	completed = true
+}
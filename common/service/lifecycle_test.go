@@ -0,0 +1,33 @@
+package service_test
+
+import (
+	"github.com/juju/errors"
+	gc "gopkg.in/check.v1"
+
+	"../service"
+)
+
+// ControllerLifecycle bootstraps and destroys controllers, reporting
+// problems as errors.
+func (s *FakeJujuRunnerSuite) TestControllerLifecycle(c *gc.C) {
+	lifecycle := service.NewControllerLifecycle(s.options)
+	c.Assert(lifecycle.SetUp(), gc.IsNil)
+	c.Assert(lifecycle.Service(), gc.IsNil)
+
+	c.Assert(lifecycle.Bootstrap(), gc.IsNil)
+	c.Assert(lifecycle.Service(), gc.NotNil)
+	err := lifecycle.Bootstrap()
+	c.Assert(err, gc.ErrorMatches, "controller already bootstrapped")
+	c.Check(errors.IsAlreadyExists(err), gc.Equals, true)
+
+	c.Assert(lifecycle.Destroy(), gc.IsNil)
+	c.Assert(lifecycle.Service(), gc.IsNil)
+	err = lifecycle.Destroy()
+	c.Assert(err, gc.ErrorMatches, "controller not bootstrapped")
+	c.Check(errors.IsNotFound(err), gc.Equals, true)
+
+	// Tearing down destroys the controller, if still bootstrapped.
+	c.Assert(lifecycle.Bootstrap(), gc.IsNil)
+	c.Assert(lifecycle.TearDown(), gc.IsNil)
+	c.Assert(lifecycle.Service(), gc.IsNil)
+}
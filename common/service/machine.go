@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api/fakejuju/params"
 	"github.com/juju/juju/instance"
 	"github.com/juju/juju/network"
 	"github.com/juju/juju/state"
@@ -14,28 +17,52 @@ import (
 	semversion "github.com/juju/version"
 )
 
-// Handle a changed machine
-func (s *FakeJujuService) handleMachineChanged(id string) error {
+// Handle a changed machine in the model of the given state
+func (s *FakeJujuService) handleMachineChanged(st *state.State, id string) error {
 	log.Infof("Handling changed machine %s", id)
 
 	// Get the machine
-	machine, err := s.state.Machine(id)
+	machine, err := st.Machine(id)
+	if errors.IsNotFound(err) {
+		// The machine was removed in the meantime (for example by a
+		// reset), we'll get a delta about the removal.
+		log.Infof("Machine %s is gone", id)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	if machine.Life() != state.Alive {
+		return s.handleMachineDying(st, machine)
+	}
 
-	st, err := machine.Status()
+	machineStatus, err := machine.Status()
 	if err != nil {
 		return err
 	}
 
-	switch st.Status {
+	// The controller machine is the one that needs to be started for
+	// the service to be ready.
+	isController := st == s.state && id == "0"
+
+	switch machineStatus.Status {
 	case status.Pending:
-		if err := s.startMachine(machine); err != nil {
+		if failure := s.getFailure(st, "machine", id); failure != nil && !failure.StuckDying {
+			return s.errorMachine(st, machine, failure)
+		}
+		if s.options.Manual && !isController {
+			// The machine will be started by an explicit
+			// StartMachine call.
+			return nil
+		}
+		if !s.isDue(st, "start", "machine", id, s.latencies.Machine) {
+			return nil
+		}
+		if err := s.startMachine(st, machine); err != nil {
 			return err
 		}
 	case status.Started:
-		if id == "0" && s.ready != nil {
+		if isController && s.ready != nil {
 			// Notify the Ready() method
 			s.ready <- nil
 			close(s.ready)
@@ -46,8 +73,33 @@ func (s *FakeJujuService) handleMachineChanged(id string) error {
 	return nil
 }
 
+// Explicitly start the machine with the given ID in the model with the
+// given UUID (or in the controller model), which must be pending. This is
+// typically used in manual mode.
+func (s *FakeJujuService) StartMachine(model, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, err := s.lookupModelState(model)
+	if err != nil {
+		return err
+	}
+	machine, err := st.Machine(id)
+	if err != nil {
+		return err
+	}
+	machineStatus, err := machine.Status()
+	if err != nil {
+		return err
+	}
+	if machineStatus.Status != status.Pending {
+		return errors.Errorf("machine %s is not pending", id)
+	}
+	return s.startMachine(st, machine)
+}
+
 // Start a machine (i.e. transition it from pending to started)
-func (s *FakeJujuService) startMachine(machine *state.Machine) error {
+func (s *FakeJujuService) startMachine(st *state.State, machine *state.Machine) error {
 
 	log.Infof("Starting machine %s", machine.Id())
 
@@ -60,7 +112,7 @@ func (s *FakeJujuService) startMachine(machine *state.Machine) error {
 	}
 
 	// Set instance state
-	if err := machine.SetProvisioned(s.newInstanceId(), "nonce", nil); err != nil {
+	if err := machine.SetProvisioned(s.newInstanceId(st), "nonce", nil); err != nil {
 		return err
 	}
 	if err := machine.SetInstanceStatus(status.StatusInfo{
@@ -90,19 +142,104 @@ func (s *FakeJujuService) startMachine(machine *state.Machine) error {
 		return err
 	}
 
-	// Set agent presence
+	// Set agent presence. We don't wait for it to be observed, since
+	// we hold the service lock (see Ready() for the controller machine).
 	if _, err := machine.SetAgentPresence(); err != nil {
 		return err
 	}
-	s.state.StartSync()
-	if err := machine.WaitAgentPresence(MediumWait); err != nil {
+	st.StartSync()
+
+	s.publishTransition("machine", machine.Id(), "start", string(status.Started))
+	return nil
+}
+
+// Mark a machine as failed to provision. The machine is left in the pending
+// state, with a provisioning error set on its instance status.
+func (s *FakeJujuService) errorMachine(st *state.State, machine *state.Machine, failure *params.Failure) error {
+
+	instanceStatus, err := machine.InstanceStatus()
+	if err != nil {
 		return err
 	}
+	if instanceStatus.Status == status.ProvisioningError {
+		return nil // Already failed, nothing to do.
+	}
+
+	log.Infof("Erroring machine %s", machine.Id())
+
+	now := time.Now()
+
+	message := failureMessage(failure, "cannot start instance")
+	if err := machine.SetInstanceStatus(status.StatusInfo{
+		Status:  status.ProvisioningError,
+		Message: message,
+		Data:    failureData(failure),
+		Since:   &now,
+	}); err != nil {
+		return err
+	}
+	s.publishTransition("machine", machine.Id(), "error", string(status.ProvisioningError))
+
+	if st == s.state && machine.Id() == "0" && s.ready != nil {
+		// Notify the Ready() method that the controller machine
+		// will never come up.
+		s.ready <- errors.NewNotProvisioned(nil, "controller machine failed: "+message)
+		close(s.ready)
+		s.ready = nil
+	}
 
 	return nil
 }
 
-func (s *FakeJujuService) newInstanceId() instance.Id {
-	s.instanceCount += 1
-	return instance.Id(fmt.Sprintf("id-%d", s.instanceCount))
+func (s *FakeJujuService) newInstanceId(st *state.State) instance.Id {
+	s.instanceCounts[st.ModelUUID()] += 1
+	return instance.Id(fmt.Sprintf("id-%d", s.instanceCounts[st.ModelUUID()]))
+}
+
+// Return a summary of all machines in the model with the given UUID (or in
+// the controller model).
+func (s *FakeJujuService) Machines(model string) ([]params.Machine, error) {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return nil, err
+	}
+	machines, err := st.AllMachines()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]params.Machine, len(machines))
+	for i, machine := range machines {
+		if infos[i], err = newMachineInfo(machine); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func newMachineInfo(machine *state.Machine) (params.Machine, error) {
+	info := params.Machine{
+		Id:     machine.Id(),
+		Life:   machine.Life().String(),
+		Series: machine.Series(),
+	}
+
+	instanceId, err := machine.InstanceId()
+	if err != nil && !errors.IsNotProvisioned(err) {
+		return info, err
+	}
+	info.InstanceId = string(instanceId)
+
+	st, err := machine.Status()
+	if err != nil {
+		return info, err
+	}
+	info.Status = newStatus(st)
+
+	st, err = machine.InstanceStatus()
+	if err != nil {
+		return info, err
+	}
+	info.InstanceStatus = newStatus(st)
+
+	return info, nil
 }
@@ -3,8 +3,10 @@ package service_test
 import (
 	gc "gopkg.in/check.v1"
 
+	"github.com/juju/juju/api/fakejuju/params"
 	"github.com/juju/juju/state"
 	"github.com/juju/juju/status"
+	jujutesting "github.com/juju/juju/testing"
 	"github.com/juju/juju/version"
 
 	"../service"
@@ -54,3 +56,94 @@ func (s *FakeJujuServiceSuite) TestWatchLoopStartMachine(c *gc.C) {
 		version.Current.String()+"-xenial-amd64")
 
 }
+
+// The Machines() method returns a summary of all machines in the model.
+func (s *FakeJujuServiceSuite) TestMachines(c *gc.C) {
+	_, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+
+	machines, err := s.service.Machines("")
+	c.Assert(err, gc.IsNil)
+	c.Assert(machines, gc.HasLen, 1)
+	c.Check(machines[0].Id, gc.Equals, "0")
+	c.Check(machines[0].Life, gc.Equals, "alive")
+	c.Check(machines[0].Series, gc.Equals, "xenial")
+	c.Check(machines[0].InstanceId, gc.Equals, "")
+	c.Check(machines[0].Status.Status, gc.Equals, string(status.Pending))
+}
+
+// Machines scheduled to fail are left pending, with a provisioning error.
+func (s *FakeJujuServiceSuite) TestWatchLoopErrorMachine(c *gc.C) {
+	s.service.SetFailure("machine-0", &params.Failure{
+		Message: "no matching tools available",
+	})
+
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+
+	var instanceStatus status.StatusInfo
+	for a := jujutesting.LongAttempt.Start(); a.Next(); {
+		s.BackingState.StartSync()
+		instanceStatus, err = machine.InstanceStatus()
+		c.Assert(err, gc.IsNil)
+		if instanceStatus.Status == status.ProvisioningError {
+			break
+		}
+	}
+	c.Check(instanceStatus.Status, gc.Equals, status.ProvisioningError)
+	c.Check(instanceStatus.Message, gc.Equals, "no matching tools available")
+
+	// The machine agent is still pending.
+	machineStatus, err := machine.Status()
+	c.Check(err, gc.IsNil)
+	c.Check(machineStatus.Status, gc.Equals, status.Pending)
+}
+
+// In manual mode, machines other than the controller one are started only
+// upon explicit request.
+func (s *FakeJujuServiceSuite) TestManualStartMachine(c *gc.C) {
+	options := &service.FakeJujuOptions{
+		Mongo:  -1,
+		Series: "xenial",
+		Manual: true,
+	}
+	s.service = service.NewFakeJujuService(s.BackingState, s.APIState, options)
+	s.service.Start()
+	defer s.service.Stop()
+
+	template := state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	}
+	controller, err := s.BackingState.AddOneMachine(template)
+	c.Assert(err, gc.IsNil)
+	machine, err := s.BackingState.AddOneMachine(template)
+	c.Assert(err, gc.IsNil)
+
+	// The controller machine gets started automatically.
+	s.BackingState.StartSync()
+	c.Assert(controller.WaitAgentPresence(service.MediumWait), gc.IsNil)
+
+	// The other one is left pending.
+	machineStatus, err := machine.Status()
+	c.Assert(err, gc.IsNil)
+	c.Check(machineStatus.Status, gc.Equals, status.Pending)
+
+	c.Assert(s.service.StartMachine("", machine.Id()), gc.IsNil)
+	machineStatus, err = machine.Status()
+	c.Assert(err, gc.IsNil)
+	c.Check(machineStatus.Status, gc.Equals, status.Started)
+
+	// Trying to start it again fails.
+	err = s.service.StartMachine("", machine.Id())
+	c.Check(err, gc.ErrorMatches, "machine 1 is not pending")
+}
@@ -0,0 +1,176 @@
+// Track hosted models, so their entities get handled too
+
+package service
+
+import (
+	"github.com/juju/errors"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/juju/state"
+)
+
+// A hosted model (i.e. one created with "juju add-model") being watched.
+type hostedModel struct {
+	state   *state.State
+	watcher *state.Multiwatcher
+}
+
+// Return the State for the model with the given UUID, or nil if the model
+// is not being watched. An empty UUID means the controller model.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) modelState(uuid string) *state.State {
+	if uuid == "" || uuid == s.state.ModelUUID() {
+		return s.state
+	}
+	if model, ok := s.models[uuid]; ok {
+		return model.state
+	}
+	return nil
+}
+
+// Return the State for the model with the given UUID, or an error
+// satisfying errors.IsNotFound if the model is not being watched. An empty
+// UUID means the controller model.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) lookupModelState(uuid string) (*state.State, error) {
+	if st := s.modelState(uuid); st != nil {
+		return st, nil
+	}
+	return nil, errors.NotFoundf("model %s", uuid)
+}
+
+// Same as lookupModelState, for methods that don't hold the service lock.
+func (s *FakeJujuService) getModelState(uuid string) (*state.State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lookupModelState(uuid)
+}
+
+// Watch for models being added or destroyed, and start or stop their watch
+// loops accordingly. The loop will terminate when the Stop() method is
+// called, at which point all hosted model watch loops are stopped too.
+func (s *FakeJujuService) watchModels() {
+	for uuids := range s.modelsWatcher.Changes() {
+		for _, uuid := range uuids {
+			if err := s.handleModelChanged(uuid); err != nil {
+				log.Errorf("Model error: %s (%s)", err.Error(), uuid)
+			}
+		}
+	}
+	if err := s.modelsWatcher.Err(); err != nil {
+		log.Errorf("Models watcher error: %s", err.Error())
+	}
+
+	s.lock.Lock()
+	uuids := make([]string, 0, len(s.models))
+	for uuid := range s.models {
+		uuids = append(uuids, uuid)
+	}
+	s.lock.Unlock()
+
+	for _, uuid := range uuids {
+		s.stopModel(uuid)
+	}
+	s.modelLoops.Wait()
+
+	log.Infof("Models watch loop terminated")
+	close(s.modelsDone)
+}
+
+// Handle a model being added, changed or removed.
+func (s *FakeJujuService) handleModelChanged(uuid string) error {
+	if uuid == s.state.ModelUUID() {
+		return nil // The controller model is always watched
+	}
+
+	model, err := s.state.GetModel(names.NewModelTag(uuid))
+	if errors.IsNotFound(err) || (err == nil && model.Life() == state.Dead) {
+		s.stopModel(uuid)
+		s.ClearModelFailures(uuid)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	_, ok := s.models[uuid]
+	s.lock.Unlock()
+	if ok {
+		return nil
+	}
+
+	return s.startModel(uuid)
+}
+
+// Start watching the hosted model with the given UUID.
+func (s *FakeJujuService) startModel(uuid string) error {
+	log.Infof("Starting watch loop for model %s", uuid)
+
+	st, err := s.state.ForModel(names.NewModelTag(uuid))
+	if err != nil {
+		return err
+	}
+	model := &hostedModel{
+		state:   st,
+		watcher: st.Watch(),
+	}
+
+	s.lock.Lock()
+	s.models[uuid] = model
+	s.lock.Unlock()
+
+	s.modelLoops.Add(1)
+	go s.watchModel(uuid, model)
+	return nil
+}
+
+// Stop watching the hosted model with the given UUID, if it's watched.
+func (s *FakeJujuService) stopModel(uuid string) {
+	s.lock.Lock()
+	model, ok := s.models[uuid]
+	delete(s.models, uuid)
+	s.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	log.Infof("Stopping watch loop for model %s", uuid)
+	if err := model.watcher.Stop(); err != nil {
+		log.Errorf("Can't stop watcher for model %s: %s", uuid, err.Error())
+	}
+}
+
+// Watch a hosted model and react to changes. Unlike the controller model
+// watch loop, errors are logged but don't cause the service to terminate.
+func (s *FakeJujuService) watchModel(uuid string, model *hostedModel) {
+	defer s.modelLoops.Done()
+	defer model.state.Close()
+	defer func() {
+		// Forget about the model if the loop terminated because of a
+		// watcher error, rather than because of stopModel().
+		s.lock.Lock()
+		if s.models[uuid] == model {
+			delete(s.models, uuid)
+		}
+		s.lock.Unlock()
+	}()
+
+	for {
+		deltas, err := model.watcher.Next()
+		if err != nil {
+			if err.Error() != state.ErrStopped.Error() {
+				log.Errorf("Watcher error for model %s: %s", uuid, err.Error())
+			}
+			break
+		}
+		for _, delta := range deltas {
+			if err := s.handleDelta(delta); err != nil {
+				log.Errorf("Delta error: %s (%v)", err.Error(), delta)
+			}
+		}
+	}
+	log.Infof("Watch loop for model %s terminated", uuid)
+}
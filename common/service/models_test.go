@@ -0,0 +1,80 @@
+package service_test
+
+import (
+	"github.com/juju/errors"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/status"
+	jujutesting "github.com/juju/juju/testing"
+
+	"../service"
+)
+
+// Machines added to hosted models get started too.
+func (s *FakeJujuServiceSuite) TestWatchLoopHostedModel(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	st := s.Factory.MakeModel(c, nil)
+	defer st.Close()
+
+	machine, err := st.AddOneMachine(state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+
+	st.StartSync()
+	err = machine.WaitAgentPresence(2 * service.MediumWait)
+	c.Assert(err, gc.IsNil)
+
+	machineStatus, err := machine.Status()
+	c.Check(err, gc.IsNil)
+	c.Check(machineStatus.Status, gc.Equals, status.Started)
+}
+
+// Control plane methods act on the model with the given UUID.
+func (s *FakeJujuServiceSuite) TestHostedModelControlPlane(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	template := state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	}
+	_, err := s.BackingState.AddOneMachine(template)
+	c.Assert(err, gc.IsNil)
+
+	st := s.Factory.MakeModel(c, nil)
+	defer st.Close()
+
+	machine, err := st.AddOneMachine(template)
+	c.Assert(err, gc.IsNil)
+	st.StartSync()
+
+	condition, err := service.ParseCondition("machine 0 status=started")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor(st.ModelUUID(), condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+
+	// Instance IDs are generated per model.
+	machines, err := s.service.Machines(st.ModelUUID())
+	c.Assert(err, gc.IsNil)
+	c.Assert(machines, gc.HasLen, 1)
+	c.Check(machines[0].Id, gc.Equals, machine.Id())
+	c.Check(machines[0].InstanceId, gc.Equals, "id-1")
+
+	// Resetting the hosted model leaves the controller model alone.
+	c.Assert(s.service.Reset(st.ModelUUID()), gc.IsNil)
+	machines, err = s.service.Machines(st.ModelUUID())
+	c.Assert(err, gc.IsNil)
+	c.Check(machines, gc.HasLen, 0)
+	machines, err = s.service.Machines("")
+	c.Assert(err, gc.IsNil)
+	c.Check(machines, gc.HasLen, 1)
+
+	_, err = s.service.Units("deadbeef-0bad-400d-8000-4b1d0d06f00e")
+	c.Check(errors.IsNotFound(err), gc.Equals, true)
+}
@@ -0,0 +1,419 @@
+// Handle changes to relation entities
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/status"
+)
+
+// The prefix of the message of units blocked because required relations
+// are not established.
+const missingRelationsMessage = "missing relations: "
+
+// Handle a changed relation in the model of the given state, making the
+// started units of the participating applications enter its scope (or
+// leave it, if the relation is dying, so that it can be removed), and
+// updating the workload status of the ones blocked on missing relations.
+func (s *FakeJujuService) handleRelationChanged(st *state.State, key string) error {
+	log.Infof("Handling changed relation %s", key)
+
+	relation, err := st.KeyRelation(key)
+	if errors.IsNotFound(err) {
+		// The relation was removed in the meantime (for example by a
+		// reset), we'll get a delta about the removal.
+		log.Infof("Relation %s is gone", key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range relation.Endpoints() {
+		application, err := st.Application(endpoint.ApplicationName)
+		if errors.IsNotFound(err) {
+			continue // Removed along with the relation
+		}
+		if err != nil {
+			return err
+		}
+		units, err := application.AllUnits()
+		if err != nil {
+			return err
+		}
+		for _, unit := range units {
+			switch relation.Life() {
+			case state.Alive:
+				if err := s.enterRelationScope(st, relation, unit); err != nil {
+					return err
+				}
+			case state.Dying:
+				if err := s.leaveRelationScope(relation, unit); err != nil {
+					return err
+				}
+			}
+			if err := s.updateMissingRelationsStatus(st, unit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Make the given unit enter the scopes of all the relations of its
+// application.
+func (s *FakeJujuService) enterRelationScopes(st *state.State, unit *state.Unit) error {
+	application, err := unit.Application()
+	if err != nil {
+		return err
+	}
+	relations, err := application.Relations()
+	if err != nil {
+		return err
+	}
+	for _, relation := range relations {
+		if relation.Life() != state.Alive {
+			continue
+		}
+		if err := s.enterRelationScope(st, relation, unit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Make the given unit enter the scope of the given relation, unless it's
+// not started yet or it's already in scope. The unit settings will contain
+// its private address, along with the settings set through the control
+// plane API (if any).
+//
+// For subordinate relations, this creates the subordinate unit. Errors
+// entering the scope are logged and otherwise ignored, since they can be
+// caused by the relation being removed concurrently.
+func (s *FakeJujuService) enterRelationScope(st *state.State, relation *state.Relation, unit *state.Unit) error {
+	if unit.Life() != state.Alive {
+		return nil
+	}
+	agentStatus, err := unit.AgentStatus()
+	if err != nil {
+		return err
+	}
+	if agentStatus.Status == status.Allocating {
+		return nil // The unit will enter scope when started
+	}
+
+	relationUnit, err := relation.Unit(unit)
+	if err != nil {
+		return err
+	}
+	inScope, err := relationUnit.InScope()
+	if err != nil || inScope {
+		return err
+	}
+
+	settings := make(map[string]interface{})
+	if address, err := unit.PrivateAddress(); err == nil {
+		settings["private-address"] = address.Value
+	}
+	for key, value := range s.relationSettings[relationSettingsKey(st, relation.Id(), unit.Name())] {
+		settings[key] = value
+	}
+
+	log.Infof("Unit %s entering scope of relation %s", unit.Name(), relation)
+	err = relationUnit.EnterScope(settings)
+	switch errors.Cause(err) {
+	case nil:
+	case state.ErrCannotEnterScope, state.ErrCannotEnterScopeYet:
+		// The relation or the unit is going away in the meantime (for
+		// example because of a remove-relation), or a subordinate can't
+		// be created yet. We'll get another delta if that changes.
+		log.Infof("Unit %s cannot enter scope of relation %s", unit.Name(), relation)
+		return nil
+	default:
+		log.Errorf("Cannot enter scope of relation %s: %s (unit %s)", relation, err.Error(), unit.Name())
+		return nil
+	}
+	s.publishTransition("relation", relation.String(), "enter-scope", unit.Name())
+	return nil
+}
+
+// Make the given unit leave the scope of the given relation, if it's in
+// scope. The relation is removed once the last unit leaves its scope.
+func (s *FakeJujuService) leaveRelationScope(relation *state.Relation, unit *state.Unit) error {
+	relationUnit, err := relation.Unit(unit)
+	if err != nil {
+		return err
+	}
+	inScope, err := relationUnit.InScope()
+	if err != nil || !inScope {
+		return err
+	}
+
+	log.Infof("Unit %s leaving scope of relation %s", unit.Name(), relation)
+	if err := relationUnit.LeaveScope(); err != nil {
+		return err
+	}
+	s.publishTransition("relation", relation.String(), "leave-scope", unit.Name())
+	return nil
+}
+
+// Return the given workload status, unless it's active and the charm of the
+// unit with the given name requires relations that are not established, in
+// which case return a blocked status listing them.
+func missingRelationsStatus(st *state.State, name string, workload *params.Status) (*params.Status, error) {
+	if workload == nil || status.Status(workload.Status) != status.Active {
+		return workload, nil
+	}
+	unit, err := st.Unit(name)
+	if err != nil {
+		return nil, err
+	}
+	missing, err := missingRelations(unit)
+	if err != nil || len(missing) == 0 {
+		return workload, err
+	}
+	return &params.Status{
+		Status:  string(status.Blocked),
+		Message: missingRelationsMessage + strings.Join(missing, ", "),
+	}, nil
+}
+
+// Update the workload status of the given unit if it's blocked on missing
+// relations, according to the relations currently established. Other
+// statuses, for example set explicitly through the control plane API, are
+// left alone.
+func (s *FakeJujuService) updateMissingRelationsStatus(st *state.State, unit *state.Unit) error {
+	current, err := unit.Status()
+	if err != nil {
+		return err
+	}
+	if current.Status != status.Blocked || !strings.HasPrefix(current.Message, missingRelationsMessage) {
+		return nil
+	}
+	workload, err := missingRelationsStatus(st, unit.Name(), &params.Status{Status: string(status.Active)})
+	if err != nil {
+		return err
+	}
+	if status.Status(workload.Status) == current.Status && workload.Message == current.Message {
+		return nil
+	}
+	return s.setUnitStatus(st, unit.Name(), nil, workload)
+}
+
+// Return the sorted names of the non-optional "requires" endpoints of the
+// charm of the given unit, that don't have an alive relation.
+func missingRelations(unit *state.Unit) ([]string, error) {
+	application, err := unit.Application()
+	if err != nil {
+		return nil, err
+	}
+	charm, _, err := application.Charm()
+	if err != nil {
+		return nil, err
+	}
+	relations, err := application.Relations()
+	if err != nil {
+		return nil, err
+	}
+	established := make(map[string]bool)
+	for _, relation := range relations {
+		if relation.Life() != state.Alive {
+			continue
+		}
+		endpoint, err := relation.Endpoint(application.Name())
+		if err != nil {
+			return nil, err
+		}
+		established[endpoint.Name] = true
+	}
+	var missing []string
+	for name, relation := range charm.Meta().Requires {
+		if !relation.Optional && !established[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// Make the given unit leave the scopes of all its relations.
+func leaveRelationScopes(unit *state.Unit) error {
+	relations, err := unit.RelationsInScope()
+	if err != nil {
+		return err
+	}
+	for _, relation := range relations {
+		relationUnit, err := relation.Unit(unit)
+		if err != nil {
+			return err
+		}
+		if err := relationUnit.LeaveScope(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the relation settings of the given unit, which must be in the
+// scope of the relation with the given ID, in the model with the given UUID
+// (or in the controller model).
+func (s *FakeJujuService) RelationSettings(model string, id int, name string) (map[string]interface{}, error) {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return nil, err
+	}
+	_, relationUnit, err := getRelationUnit(st, id, name)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := relationUnit.Settings()
+	if err != nil {
+		return nil, err
+	}
+	return settings.Map(), nil
+}
+
+// Set relation settings for the given unit in the relation with the given
+// ID, in the model with the given UUID (or in the controller model),
+// overriding the default ones. Values must be strings, and keys with a nil
+// value are deleted. The settings are applied right away if the unit is in
+// scope, otherwise when it enters the scope.
+func (s *FakeJujuService) SetRelationSettings(model string, id int, name string, settings map[string]interface{}) error {
+	for key, value := range settings {
+		if _, ok := value.(string); value != nil && !ok {
+			return errors.NotValidf("non-string value for relation setting %q", key)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, err := s.lookupModelState(model)
+	if err != nil {
+		return err
+	}
+	relation, relationUnit, err := getRelationUnit(st, id, name)
+	if err != nil {
+		return err
+	}
+
+	key := relationSettingsKey(st, id, name)
+	overrides, ok := s.relationSettings[key]
+	if !ok {
+		overrides = make(map[string]interface{})
+		s.relationSettings[key] = overrides
+	}
+	for key, value := range settings {
+		if value == nil {
+			delete(overrides, key)
+		} else {
+			overrides[key] = value
+		}
+	}
+
+	inScope, err := relationUnit.InScope()
+	if err != nil || !inScope {
+		return err
+	}
+	current, err := relationUnit.Settings()
+	if err != nil {
+		return err
+	}
+	for key, value := range settings {
+		if value == nil {
+			current.Delete(key)
+		} else {
+			current.Set(key, value)
+		}
+	}
+	log.Infof("Setting relation %d settings of unit %s", id, name)
+	if _, err := current.Write(); err != nil {
+		return err
+	}
+	s.publishTransition("relation", relation.String(), "set-settings", name)
+	return nil
+}
+
+// Return the relation with the given ID in the model of the given state,
+// and the RelationUnit for the given unit in it.
+func getRelationUnit(st *state.State, id int, name string) (*state.Relation, *state.RelationUnit, error) {
+	relation, err := st.Relation(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	unit, err := st.Unit(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	relationUnit, err := relation.Unit(unit)
+	if err != nil {
+		return nil, nil, errors.NotValidf("unit %s in relation %d", name, id)
+	}
+	return relation, relationUnit, nil
+}
+
+// The key of the relation settings overrides for the given unit.
+func relationSettingsKey(st *state.State, id int, name string) string {
+	return fmt.Sprintf("%s:%d:%s", st.ModelUUID(), id, name)
+}
+
+// Return a summary of all relations in the model with the given UUID (or in
+// the controller model).
+func (s *FakeJujuService) Relations(model string) ([]params.Relation, error) {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return nil, err
+	}
+	relations, err := st.AllRelations()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]params.Relation, len(relations))
+	for i, relation := range relations {
+		if infos[i], err = newRelationInfo(st, relation); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func newRelationInfo(st *state.State, relation *state.Relation) (params.Relation, error) {
+	info := params.Relation{
+		Id:        relation.Id(),
+		Key:       relation.String(),
+		Life:      relation.Life().String(),
+		Endpoints: []string{},
+		Units:     []string{},
+	}
+	for _, endpoint := range relation.Endpoints() {
+		info.Endpoints = append(info.Endpoints, endpoint.String())
+		application, err := st.Application(endpoint.ApplicationName)
+		if err != nil {
+			return info, err
+		}
+		units, err := application.AllUnits()
+		if err != nil {
+			return info, err
+		}
+		for _, unit := range units {
+			relationUnit, err := relation.Unit(unit)
+			if err != nil {
+				return info, err
+			}
+			inScope, err := relationUnit.InScope()
+			if err != nil {
+				return info, err
+			}
+			if inScope {
+				info.Units = append(info.Units, unit.Name())
+			}
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,238 @@
+package service_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+	"github.com/juju/juju/testing/factory"
+
+	"../service"
+)
+
+// Started units enter the scope of new relations, with their private
+// address as relation settings, which can be changed later.
+func (s *FakeJujuServiceSuite) TestWatchLoopRelation(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	for _, name := range []string{"mysql", "wordpress"} {
+		charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+			Name:   name,
+			Series: "quantal",
+		})
+		application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+			Name:  name,
+			Charm: charm,
+		})
+		unit, err := application.AddUnit()
+		c.Assert(err, gc.IsNil)
+		c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	}
+	endpoints, err := s.BackingState.InferEndpoints("mysql", "wordpress")
+	c.Assert(err, gc.IsNil)
+	relation, err := s.BackingState.AddRelation(endpoints...)
+	c.Assert(err, gc.IsNil)
+
+	// Units start and enter the relation scope.
+	for a := jujutesting.LongAttempt.Start(); a.Next(); {
+		s.BackingState.StartSync()
+		relations, err := s.service.Relations("")
+		c.Assert(err, gc.IsNil)
+		c.Assert(relations, gc.HasLen, 1)
+		if len(relations[0].Units) == 2 {
+			break
+		}
+		c.Assert(a.HasNext(), gc.Equals, true)
+	}
+
+	settings, err := s.service.RelationSettings("", relation.Id(), "mysql/0")
+	c.Assert(err, gc.IsNil)
+	c.Check(settings["private-address"], gc.Equals, "127.0.0.1")
+
+	err = s.service.SetRelationSettings("", relation.Id(), "mysql/0", map[string]interface{}{
+		"user":            "admin",
+		"private-address": nil,
+	})
+	c.Assert(err, gc.IsNil)
+	settings, err = s.service.RelationSettings("", relation.Id(), "mysql/0")
+	c.Assert(err, gc.IsNil)
+	c.Check(settings, gc.DeepEquals, map[string]interface{}{"user": "admin"})
+
+	err = s.service.SetRelationSettings("", relation.Id(), "mysql/0", map[string]interface{}{"port": 3306})
+	c.Check(err, gc.ErrorMatches, `non-string value for relation setting "port" not valid`)
+
+	// Relation settings can't be set for units outside the relation.
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "dummy",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "dummy",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	err = s.service.SetRelationSettings("", relation.Id(), unit.Name(), nil)
+	c.Check(err, gc.ErrorMatches, `unit dummy/0 in relation \d+ not valid`)
+	_, err = s.service.RelationSettings("", relation.Id(), unit.Name())
+	c.Check(err, gc.ErrorMatches, `unit dummy/0 in relation \d+ not valid`)
+}
+
+// Units leave the scope of destroyed relations, which are then removed.
+func (s *FakeJujuServiceSuite) TestWatchLoopRelationRemoved(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	for _, name := range []string{"mysql", "wordpress"} {
+		charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+			Name:   name,
+			Series: "quantal",
+		})
+		application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+			Name:  name,
+			Charm: charm,
+		})
+		unit, err := application.AddUnit()
+		c.Assert(err, gc.IsNil)
+		c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	}
+	endpoints, err := s.BackingState.InferEndpoints("mysql", "wordpress")
+	c.Assert(err, gc.IsNil)
+	relation, err := s.BackingState.AddRelation(endpoints...)
+	c.Assert(err, gc.IsNil)
+
+	for a := jujutesting.LongAttempt.Start(); a.Next(); {
+		s.BackingState.StartSync()
+		relations, err := s.service.Relations("")
+		c.Assert(err, gc.IsNil)
+		c.Assert(relations, gc.HasLen, 1)
+		if len(relations[0].Units) == 2 {
+			break
+		}
+		c.Assert(a.HasNext(), gc.Equals, true)
+	}
+
+	c.Assert(relation.Destroy(), gc.IsNil)
+	s.waitRemoved(c, relation)
+	relations, err := s.service.Relations("")
+	c.Assert(err, gc.IsNil)
+	c.Check(relations, gc.HasLen, 0)
+}
+
+// Units whose charm requires relations that are not established are
+// blocked, and become active once the relations are added.
+func (s *FakeJujuServiceSuite) TestWatchLoopMissingRelations(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	for _, name := range []string{"mysql", "wordpress"} {
+		charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+			Name:   name,
+			Series: "quantal",
+		})
+		application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+			Name:  name,
+			Charm: charm,
+		})
+		unit, err := application.AddUnit()
+		c.Assert(err, gc.IsNil)
+		c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	}
+	s.BackingState.StartSync()
+
+	for _, text := range []string{
+		"unit mysql/0 agent=idle workload=active",
+		"unit wordpress/0 agent=idle workload=blocked",
+	} {
+		condition, err := service.ParseCondition(text)
+		c.Assert(err, gc.IsNil)
+		result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+		c.Assert(err, gc.IsNil)
+		c.Assert(result.Matched, gc.Equals, true, gc.Commentf(text))
+	}
+	unit, err := s.BackingState.Unit("wordpress/0")
+	c.Assert(err, gc.IsNil)
+	workloadStatus, err := unit.Status()
+	c.Assert(err, gc.IsNil)
+	c.Check(workloadStatus.Message, gc.Equals, "missing relations: db")
+
+	endpoints, err := s.BackingState.InferEndpoints("mysql", "wordpress")
+	c.Assert(err, gc.IsNil)
+	_, err = s.BackingState.AddRelation(endpoints...)
+	c.Assert(err, gc.IsNil)
+	s.BackingState.StartSync()
+
+	condition, err := service.ParseCondition("unit wordpress/0 workload=active")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+}
+
+// Workload statuses set explicitly are not affected by missing relations.
+func (s *FakeJujuServiceSuite) TestExplicitStatusWithMissingRelations(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	for _, name := range []string{"mysql", "wordpress"} {
+		charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+			Name:   name,
+			Series: "quantal",
+		})
+		application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+			Name:  name,
+			Charm: charm,
+		})
+		unit, err := application.AddUnit()
+		c.Assert(err, gc.IsNil)
+		c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	}
+	endpoints, err := s.BackingState.InferEndpoints("mysql", "wordpress")
+	c.Assert(err, gc.IsNil)
+	relation, err := s.BackingState.AddRelation(endpoints...)
+	c.Assert(err, gc.IsNil)
+	s.BackingState.StartSync()
+
+	condition, err := service.ParseCondition("unit wordpress/0 agent=idle workload=active")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+
+	workload := &params.Status{Status: "active", Message: "serving"}
+	c.Assert(s.service.SetUnitStatus("", "wordpress/0", nil, workload), gc.IsNil)
+
+	// Removing the relation leaves the explicit status alone.
+	c.Assert(relation.Destroy(), gc.IsNil)
+	s.BackingState.StartSync()
+	condition, err = service.ParseCondition("unit wordpress/0 workload=blocked")
+	c.Assert(err, gc.IsNil)
+	result, err = s.service.WaitFor("", condition, service.MediumWait)
+	c.Assert(err, gc.IsNil)
+	c.Check(result.Matched, gc.Equals, false)
+	info := params.Unit{}
+	c.Assert(result.Decode(&info), gc.IsNil)
+	c.Check(info.WorkloadStatus.Message, gc.Equals, "serving")
+}
@@ -0,0 +1,95 @@
+// Drive dying units and machines through the end of their lifecycle
+
+package service
+
+import (
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/environs"
+	"github.com/juju/juju/instance"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/state/stateenvirons"
+)
+
+// Handle a unit that is dying (or already dead), making it leave its
+// relations, and then removing it along with its subordinates, like its
+// agent would do. The removal is delayed according to the removal latency,
+// and doesn't happen at all if the unit is scheduled to be stuck dying.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) handleUnitDying(st *state.State, unit *state.Unit) error {
+	if failure := s.getFailure(st, "unit", unit.Name()); failure != nil && failure.StuckDying {
+		log.Infof("Keeping unit %s dying", unit.Name())
+		return nil
+	}
+	if !s.isDue(st, "remove", "unit", unit.Name(), s.latencies.Removal) {
+		return nil
+	}
+
+	log.Infof("Removing unit %s", unit.Name())
+	if err := removeUnit(st, unit); err != nil {
+		return err
+	}
+	s.publishTransition("unit", unit.Name(), "remove", state.Dead.String())
+	return nil
+}
+
+// Handle a machine that is dying (or already dead), releasing its instance
+// and removing it once it has no units or containers left. The removal is
+// delayed according to the removal latency, and doesn't happen at all if
+// the machine is scheduled to be stuck dying.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) handleMachineDying(st *state.State, machine *state.Machine) error {
+	id := machine.Id()
+	if st == s.state && id == "0" {
+		return nil // The controller machine can't be removed
+	}
+	if failure := s.getFailure(st, "machine", id); failure != nil && failure.StuckDying {
+		log.Infof("Keeping machine %s dying", id)
+		return nil
+	}
+	if !s.isDue(st, "remove", "machine", id, s.latencies.Removal) {
+		return nil
+	}
+
+	err := machine.EnsureDead()
+	if state.IsHasAssignedUnitsError(err) || state.IsHasContainersError(err) {
+		// We'll get another delta once the units are removed, and
+		// containers trigger the handling of their host when removed.
+		log.Infof("Machine %s still has units or containers", id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if instanceId, err := machine.InstanceId(); err == nil {
+		log.Infof("Releasing instance %s of machine %s", instanceId, id)
+		if err := stopInstance(st, instanceId); err != nil {
+			return errors.Annotatef(err, "cannot release instance %s", instanceId)
+		}
+	} else if !errors.IsNotProvisioned(err) {
+		return err
+	}
+	log.Infof("Removing machine %s", id)
+	if err := machine.Remove(); err != nil {
+		return err
+	}
+	s.publishTransition("machine", id, "remove", state.Dead.String())
+
+	if parentId, ok := machine.ParentId(); ok {
+		return s.handleMachineChanged(st, parentId)
+	}
+	return nil
+}
+
+// Stop the given instance in the environ of the model of the given state,
+// so that the dummy provider forgets about it.
+func stopInstance(st *state.State, id instance.Id) error {
+	env, err := stateenvirons.GetNewEnvironFunc(environs.New)(st)
+	if err != nil {
+		return err
+	}
+	return env.StopInstances(id)
+}
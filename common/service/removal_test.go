@@ -0,0 +1,152 @@
+package service_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+	"github.com/juju/juju/testing/factory"
+
+	"../service"
+)
+
+// Destroyed units and machines are removed, unless scheduled to be stuck
+// dying, in which case they're removed once the failure is removed.
+func (s *FakeJujuServiceSuite) TestWatchLoopRemoval(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	s.service.SetFailure("unit-mysql-1", &params.Failure{StuckDying: true})
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	var units []*state.Unit
+	for i := 0; i < 2; i++ {
+		unit, err := application.AddUnit()
+		c.Assert(err, gc.IsNil)
+		c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+		units = append(units, unit)
+	}
+	s.BackingState.StartSync()
+	for _, text := range []string{
+		"unit mysql/0 agent=idle",
+		"unit mysql/1 agent=idle",
+	} {
+		condition, err := service.ParseCondition(text)
+		c.Assert(err, gc.IsNil)
+		result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+		c.Assert(err, gc.IsNil)
+		c.Assert(result.Matched, gc.Equals, true, gc.Commentf(text))
+	}
+
+	for _, unit := range units {
+		c.Assert(unit.Destroy(), gc.IsNil)
+	}
+	s.BackingState.StartSync()
+	s.waitRemoved(c, units[0])
+	c.Assert(units[1].Refresh(), gc.IsNil)
+	c.Check(units[1].Life(), gc.Equals, state.Dying)
+
+	c.Assert(s.service.RemoveFailure("", "unit-mysql-1"), gc.IsNil)
+	s.waitRemoved(c, units[1])
+
+	c.Assert(machine.Destroy(), gc.IsNil)
+	s.waitRemoved(c, machine)
+}
+
+// Units kept dying by a failure are removed once all failures are cleared.
+func (s *FakeJujuServiceSuite) TestWatchLoopRemovalClearFailures(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	s.service.SetFailure("unit-mysql-0", &params.Failure{StuckDying: true})
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.BackingState.StartSync()
+	condition, err := service.ParseCondition("unit mysql/0 agent=idle")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+
+	c.Assert(unit.Destroy(), gc.IsNil)
+	s.BackingState.StartSync()
+	time.Sleep(500 * time.Millisecond)
+	c.Assert(unit.Refresh(), gc.IsNil)
+	c.Check(unit.Life(), gc.Equals, state.Dying)
+
+	c.Assert(s.service.RemoveFailures(""), gc.IsNil)
+	s.waitRemoved(c, unit)
+}
+
+// Wait for the given entity (e.g. a unit or a machine) to be removed.
+func (s *FakeJujuServiceSuite) waitRemoved(c *gc.C, entity interface {
+	Refresh() error
+}) {
+	for a := jujutesting.LongAttempt.Start(); a.Next(); {
+		s.BackingState.StartSync()
+		if err := entity.Refresh(); errors.IsNotFound(err) {
+			return
+		}
+	}
+	c.Fatalf("entity not removed: %v", entity)
+}
+
+// Machines destroyed while their start is delayed are removed according
+// to the removal latency, not when the start latency expires.
+func (s *FakeJujuServiceSuite) TestWatchLoopRemovalLatency(c *gc.C) {
+	s.service.SetLatencies(params.Latencies{
+		Machine: params.Latency{Delay: 100 * time.Millisecond},
+		Removal: params.Latency{Delay: service.MediumWait},
+	})
+	s.service.Start()
+	defer s.service.Stop()
+
+	template := state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	}
+	_, err := s.BackingState.AddOneMachine(template)
+	c.Assert(err, gc.IsNil)
+	machine, err := s.BackingState.AddOneMachine(template)
+	c.Assert(err, gc.IsNil)
+	c.Assert(machine.Destroy(), gc.IsNil)
+	s.BackingState.StartSync()
+
+	// The start latency expires, but the machine is still dying.
+	time.Sleep(500 * time.Millisecond)
+	c.Assert(machine.Refresh(), gc.IsNil)
+	c.Check(machine.Life(), gc.Equals, state.Dying)
+
+	s.waitRemoved(c, machine)
+}
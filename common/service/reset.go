@@ -0,0 +1,201 @@
+// Reset the model to its bootstrap state
+
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/state"
+)
+
+// Remove all applications, units and machines (except the controller one)
+// from the model with the given UUID (or from the controller model), and
+// clear its failures. Resetting the controller model also clears the action
+// results registry and stops the scenario being played. The controller and
+// its API server are left running, so this is much faster than destroying
+// and bootstrapping again.
+func (s *FakeJujuService) Reset(model string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, err := s.lookupModelState(model)
+	if err != nil {
+		return err
+	}
+	uuid := st.ModelUUID()
+	isController := st == s.state
+
+	log.Infof("Resetting model %s", uuid)
+
+	applications, err := st.AllApplications()
+	if err != nil {
+		return err
+	}
+	for _, application := range applications {
+		if err := removeApplication(st, application); err != nil {
+			return errors.Annotatef(err, "cannot remove application %s", application.Name())
+		}
+	}
+
+	machines, err := st.AllMachines()
+	if err != nil {
+		return err
+	}
+	// Remove containers before their hosts.
+	sort.Sort(byDepthDescending(machines))
+	for _, machine := range machines {
+		if isController && machine.Id() == "0" {
+			continue
+		}
+		if err := removeMachine(st, machine); err != nil {
+			return errors.Annotatef(err, "cannot remove machine %s", machine.Id())
+		}
+	}
+
+	if isController {
+		// Machine 0 is the only one left, and it holds the first
+		// instance ID.
+		s.instanceCounts[uuid] = 1
+		s.stopScenario()
+		s.ClearActionResults()
+	} else {
+		delete(s.instanceCounts, uuid)
+	}
+	for key := range s.timers {
+		if strings.HasPrefix(key, uuid+":") {
+			delete(s.timers, key)
+		}
+	}
+	for key, timers := range s.stepsTimers {
+		if strings.HasPrefix(key, uuid+":") {
+			for _, timer := range timers {
+				timer.Stop()
+			}
+			delete(s.stepsTimers, key)
+		}
+	}
+	for key := range s.relationSettings {
+		if strings.HasPrefix(key, uuid+":") {
+			delete(s.relationSettings, key)
+		}
+	}
+	s.resetRules(uuid)
+	s.clearLeaders(uuid)
+	s.ClearModelFailures(uuid)
+
+	return nil
+}
+
+// Remove the given application along with its units and relations.
+func removeApplication(st *state.State, application *state.Application) error {
+	units, err := application.AllUnits()
+	if err != nil {
+		return err
+	}
+	for _, unit := range units {
+		if err := removeUnit(st, unit); err != nil {
+			return err
+		}
+	}
+
+	relations, err := application.Relations()
+	if err != nil {
+		return err
+	}
+	for _, relation := range relations {
+		if err := relation.Destroy(); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return application.Destroy()
+}
+
+// Destroy the given unit, along with its subordinates, and remove it from
+// the model. The unit leaves all its relation scopes first, so that the
+// relations can be removed too, and its pending and running actions get
+// cancelled.
+func removeUnit(st *state.State, unit *state.Unit) error {
+	if err := unit.Refresh(); errors.IsNotFound(err) {
+		return nil // Already removed along with its principal
+	} else if err != nil {
+		return err
+	}
+	for _, name := range unit.SubordinateNames() {
+		subordinate, err := st.Unit(name)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := removeUnit(st, subordinate); err != nil {
+			return err
+		}
+	}
+	if err := leaveRelationScopes(unit); err != nil {
+		return err
+	}
+	if err := cancelActions(unit); err != nil {
+		return err
+	}
+
+	if err := unit.Destroy(); err != nil {
+		return err
+	}
+	// Units that never had an agent running are removed right away.
+	if err := unit.Refresh(); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := unit.EnsureDead(); err != nil {
+		return err
+	}
+	return unit.Remove()
+}
+
+// Cancel the pending and running actions of the given unit.
+func cancelActions(unit *state.Unit) error {
+	pending, err := unit.PendingActions()
+	if err != nil {
+		return err
+	}
+	running, err := unit.RunningActions()
+	if err != nil {
+		return err
+	}
+	for _, action := range append(pending, running...) {
+		if _, err := unit.CancelAction(action); err != nil {
+			return errors.Annotatef(err, "cannot cancel action %s", action.Id())
+		}
+	}
+	return nil
+}
+
+// Destroy the given machine, release its instance (if any) and remove it
+// from the model of the given state.
+func removeMachine(st *state.State, machine *state.Machine) error {
+	if err := machine.EnsureDead(); err != nil {
+		return err
+	}
+	if instanceId, err := machine.InstanceId(); err == nil {
+		if err := stopInstance(st, instanceId); err != nil {
+			return err
+		}
+	} else if !errors.IsNotProvisioned(err) {
+		return err
+	}
+	return machine.Remove()
+}
+
+// Sort machines so that containers come before their hosts.
+type byDepthDescending []*state.Machine
+
+func (m byDepthDescending) Len() int      { return len(m) }
+func (m byDepthDescending) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m byDepthDescending) Less(i, j int) bool {
+	return strings.Count(m[i].Id(), "/") > strings.Count(m[j].Id(), "/")
+}
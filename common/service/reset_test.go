@@ -0,0 +1,48 @@
+package service_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/testing/factory"
+)
+
+// Reset removes everything from the model, except machine 0.
+func (s *FakeJujuServiceSuite) TestReset(c *gc.C) {
+	template := state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	}
+	_, err := s.BackingState.AddOneMachine(template)
+	c.Assert(err, gc.IsNil)
+	machine, err := s.BackingState.AddOneMachine(template)
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.service.SetFailure("unit-mysql-0", &params.Failure{})
+
+	c.Assert(s.service.Reset(""), gc.IsNil)
+
+	machines, err := s.service.Machines("")
+	c.Assert(err, gc.IsNil)
+	c.Assert(machines, gc.HasLen, 1)
+	c.Check(machines[0].Id, gc.Equals, "0")
+
+	units, err := s.service.Units("")
+	c.Assert(err, gc.IsNil)
+	c.Check(units, gc.HasLen, 0)
+
+	applications, err := s.BackingState.AllApplications()
+	c.Assert(err, gc.IsNil)
+	c.Check(applications, gc.HasLen, 0)
+
+	c.Check(s.service.Failures(), gc.HasLen, 0)
+}
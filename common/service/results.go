@@ -0,0 +1,113 @@
+// Track the results that actions should complete with
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+)
+
+// Convert the given result to the state.ActionResults used to finish an
+// action.
+func stateActionResults(r *params.ActionResult) state.ActionResults {
+	results := state.ActionResults{
+		Status:  state.ActionStatus(r.Status),
+		Results: r.Results,
+		Message: r.Message,
+	}
+	if results.Status == "" {
+		results.Status = state.ActionCompleted
+	}
+	return results
+}
+
+// The registry key for the given action and (optional) unit.
+func actionResultKey(unit, action string) string {
+	return fmt.Sprintf("%s:%s", unit, action)
+}
+
+// The given result will be used when completing matching actions.
+func (s *FakeJujuService) SetActionResult(result *params.ActionResult) {
+	s.actionResults.set(result)
+}
+
+// Return the result registered for the given action run on the given
+// unit, or nil if no result was registered.
+func (s *FakeJujuService) GetActionResult(unit, action string) *params.ActionResult {
+	return s.actionResults.get(unit, action)
+}
+
+// Return the registered action results, sorted by unit and action.
+func (s *FakeJujuService) ActionResults() []*params.ActionResult {
+	return s.actionResults.list()
+}
+
+// Clear all registered action results
+func (s *FakeJujuService) ClearActionResults() {
+	s.actionResults.clear()
+}
+
+// Registered action results, keyed by unit and action. It's written by
+// control plane API handlers and read by watch loops, so it has its own
+// lock rather than relying on the service one.
+type actionResultRegistry struct {
+	mutex   sync.Mutex
+	results map[string]*params.ActionResult
+}
+
+func newActionResultRegistry() *actionResultRegistry {
+	return &actionResultRegistry{results: make(map[string]*params.ActionResult)}
+}
+
+// Register a result. A copy is stored, so the caller is free to modify the
+// given one afterwards.
+func (r *actionResultRegistry) set(result *params.ActionResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stored := *result
+	r.results[actionResultKey(result.Unit, result.Action)] = &stored
+}
+
+// Return a copy of the result for the given unit and action, falling back
+// to the one for all units, or nil.
+func (r *actionResultRegistry) get(unit, action string) *params.ActionResult {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stored, ok := r.results[actionResultKey(unit, action)]
+	if !ok {
+		stored, ok = r.results[actionResultKey("", action)]
+	}
+	if !ok {
+		return nil
+	}
+	result := *stored
+	return &result
+}
+
+// Return copies of the registered results, sorted by unit and action.
+func (r *actionResultRegistry) list() []*params.ActionResult {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	keys := make([]string, 0, len(r.results))
+	for key := range r.results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	results := make([]*params.ActionResult, len(keys))
+	for i, key := range keys {
+		stored := *r.results[key]
+		results[i] = &stored
+	}
+	return results
+}
+
+func (r *actionResultRegistry) clear() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.results = make(map[string]*params.ActionResult)
+}
@@ -0,0 +1,68 @@
+package service_test
+
+import (
+	"sync"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+)
+
+type ActionResultsSuite struct{}
+
+// Unit-specific action results take precedence over generic ones.
+func (s *FakeJujuServiceSuite) TestGetActionResult(c *gc.C) {
+	s.service.SetActionResult(&params.ActionResult{
+		Action: "backup",
+		Status: "completed",
+	})
+	s.service.SetActionResult(&params.ActionResult{
+		Action:  "backup",
+		Unit:    "mysql/1",
+		Status:  "failed",
+		Message: "disk full",
+	})
+
+	result := s.service.GetActionResult("mysql/0", "backup")
+	c.Assert(result, gc.NotNil)
+	c.Check(result.Status, gc.Equals, "completed")
+
+	result = s.service.GetActionResult("mysql/1", "backup")
+	c.Assert(result, gc.NotNil)
+	c.Check(result.Status, gc.Equals, "failed")
+	c.Check(result.Message, gc.Equals, "disk full")
+
+	c.Check(s.service.GetActionResult("mysql/0", "restore"), gc.IsNil)
+	c.Check(s.service.ActionResults(), gc.HasLen, 2)
+
+	s.service.ClearActionResults()
+	c.Check(s.service.ActionResults(), gc.HasLen, 0)
+}
+
+// The action results registry can be used concurrently.
+func (s *FakeJujuServiceSuite) TestActionResultsConcurrentAccess(c *gc.C) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.service.SetActionResult(&params.ActionResult{Action: "backup"})
+			s.service.GetActionResult("mysql/0", "backup")
+			s.service.ActionResults()
+			s.service.ClearActionResults()
+		}()
+	}
+	wg.Wait()
+	c.Check(s.service.ActionResults(), gc.HasLen, 0)
+}
+
+// Only the statuses that a finished action can have are accepted.
+func (s *ActionResultsSuite) TestValidate(c *gc.C) {
+	result := &params.ActionResult{Action: "backup", Status: "running"}
+	c.Check(result.Validate(), gc.ErrorMatches, `action status "running" not valid`)
+
+	result = &params.ActionResult{Status: "failed"}
+	c.Check(result.Validate(), gc.ErrorMatches, `empty action name not valid`)
+}
+
+var _ = gc.Suite(&ActionResultsSuite{})
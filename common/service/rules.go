@@ -0,0 +1,224 @@
+// React to entity changes according to user-defined rules
+
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/state/multiwatcher"
+)
+
+// Possible values for RuleTrigger.Event
+const (
+	// A unit was added and started. Reactions are played as part of the
+	// install sequence, right after its final step, and override its
+	// final workload status.
+	RuleEventUnitAdded = "unit-added"
+
+	// The configuration of an application changed. Reactions apply to
+	// all its units.
+	RuleEventConfigChanged = "config-changed"
+)
+
+// A set of "when X then Y" rules describing how units react to changes.
+// For example:
+//
+//   rules:
+//     - when: {event: unit-added, application: postgresql}
+//       then:
+//         - workload: {status: maintenance, message: installing}
+//         - after: 3s
+//           workload: {status: active}
+//     - when: {event: config-changed, application: bar, key: foo}
+//       then:
+//         - workload: {status: blocked, message: foo is not supported}
+type Rules struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// A single rule.
+type Rule struct {
+	When RuleTrigger   `yaml:"when"`
+	Then []*StatusStep `yaml:"then"`
+}
+
+// The change that triggers a rule.
+type RuleTrigger struct {
+
+	// The kind of change, either "unit-added" or "config-changed".
+	Event string `yaml:"event"`
+
+	// The application the rule applies to. If empty, the rule applies
+	// to all applications.
+	Application string `yaml:"application,omitempty"`
+
+	// For config-changed rules, the configuration key that must change.
+	// If empty, any change triggers the rule.
+	Key string `yaml:"key,omitempty"`
+}
+
+// Parse and validate YAML rules.
+func ParseRules(data []byte) (*Rules, error) {
+	rules := &Rules{}
+	if err := yaml.Unmarshal(data, rules); err != nil {
+		return nil, errors.Annotate(err, "cannot parse rules")
+	}
+	for i, rule := range rules.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, errors.Annotatef(err, "rule %d", i)
+		}
+	}
+	return rules, nil
+}
+
+// Check that the rule is well-formed.
+func (r *Rule) validate() error {
+	if r == nil {
+		return errors.NotValidf("empty rule")
+	}
+	switch r.When.Event {
+	case RuleEventUnitAdded:
+		if r.When.Key != "" {
+			return errors.NotValidf("key for %s event", r.When.Event)
+		}
+	case RuleEventConfigChanged:
+	default:
+		return errors.NotValidf("event %q", r.When.Event)
+	}
+	if len(r.Then) == 0 {
+		return errors.NotValidf("rule without reactions")
+	}
+	return validateStatusSteps(r.Then)
+}
+
+// Return the rules for the given event and application.
+func (r *Rules) matching(event, application string) []*Rule {
+	if r == nil {
+		return nil
+	}
+	var result []*Rule
+	for _, rule := range r.Rules {
+		if rule.When.Event != event {
+			continue
+		}
+		if rule.When.Application != "" && rule.When.Application != application {
+			continue
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
+// Replace the current rules. A nil value removes all rules.
+func (s *FakeJujuService) SetRules(rules *Rules) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rules = rules
+}
+
+// Evaluate the rules against a changed entity. Unit-added rules are not
+// evaluated here, since they are part of the install sequence (see
+// unitAddedSequence).
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) evaluateRules(st *state.State, entity multiwatcher.EntityId) error {
+	switch entity.Kind {
+	case "application":
+		return s.evaluateApplicationRules(st, entity.Id)
+	}
+	return nil
+}
+
+// Append the reactions of the unit-added rules for the given application
+// to the given install sequence. The final workload status of the sequence
+// is dropped, so that the unit doesn't look ready before the reactions
+// have been played. The given steps are left untouched.
+func (s *FakeJujuService) unitAddedSequence(application string, steps []*StatusStep) []*StatusStep {
+	rules := s.rules.matching(RuleEventUnitAdded, application)
+	if len(rules) == 0 {
+		return steps
+	}
+	n := len(steps) - 1
+	last := *steps[n]
+	last.Workload = nil
+	result := append(steps[:n:n], &last)
+	for _, rule := range rules {
+		log.Infof("Unit of %s added, applying rule", application)
+		result = append(result, rule.Then...)
+	}
+	return result
+}
+
+// Trigger config-changed rules if the configuration of the application
+// with the given name changed since it was last seen. Configurations are
+// only tracked while there are rules.
+func (s *FakeJujuService) evaluateApplicationRules(st *state.State, name string) error {
+	if s.rules == nil {
+		return nil
+	}
+	key := fmt.Sprintf("%s:%s", st.ModelUUID(), name)
+	application, err := st.Application(name)
+	if errors.IsNotFound(err) {
+		// The application was removed in the meantime, for example
+		// by a reset or by the last of its units going away.
+		log.Infof("Application %s is gone", name)
+		delete(s.rulesConfigs, key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	settings, err := application.ConfigSettings()
+	if err != nil {
+		return err
+	}
+
+	previous, seen := s.rulesConfigs[key]
+	s.rulesConfigs[key] = settings
+	if !seen {
+		return nil
+	}
+
+	for _, rule := range s.rules.matching(RuleEventConfigChanged, name) {
+		if !configChanged(previous, settings, rule.When.Key) {
+			continue
+		}
+		log.Infof("Configuration of %s changed, applying rule", name)
+		units, err := application.AllUnits()
+		if err != nil {
+			return err
+		}
+		for _, unit := range units {
+			if err := s.playStatusSteps(st, unit.Name(), rule.Then, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Forget about the configurations seen so far in the model with the given
+// UUID, for example because the model was reset.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) resetRules(uuid string) {
+	for key := range s.rulesConfigs {
+		if strings.HasPrefix(key, uuid+":") {
+			delete(s.rulesConfigs, key)
+		}
+	}
+}
+
+// Whether the given configuration key (or any key, if empty) changed.
+func configChanged(previous, current map[string]interface{}, key string) bool {
+	if key == "" {
+		return !reflect.DeepEqual(previous, current)
+	}
+	return !reflect.DeepEqual(previous[key], current[key])
+}
@@ -0,0 +1,126 @@
+package service_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+	"github.com/juju/juju/testing/factory"
+
+	"../service"
+)
+
+// Rules are parsed from YAML and validated.
+func (s *FakeJujuServiceSuite) TestParseRules(c *gc.C) {
+	rules, err := service.ParseRules([]byte(`
+rules:
+  - when: {event: unit-added, application: postgresql}
+    then:
+      - workload: {status: maintenance, message: installing}
+      - after: 3s
+        workload: {status: active}
+  - when: {event: config-changed, application: bar, key: foo}
+    then:
+      - workload: {status: blocked}
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(rules.Rules, gc.HasLen, 2)
+	c.Check(rules.Rules[0].Then[1].After, gc.Equals, "3s")
+	c.Check(rules.Rules[1].When.Key, gc.Equals, "foo")
+
+	_, err = service.ParseRules([]byte("rules: [{when: {event: unit-removed}, then: [{workload: {status: active}}]}]"))
+	c.Check(err, gc.ErrorMatches, `rule 0: event "unit-removed" not valid`)
+	_, err = service.ParseRules([]byte("rules: [{when: {event: unit-added}, then: [{after: soon}]}]"))
+	c.Check(err, gc.ErrorMatches, `rule 0: step 0: delay "soon" not valid`)
+}
+
+// Units react to being added according to the rules.
+func (s *FakeJujuServiceSuite) TestRulesUnitAdded(c *gc.C) {
+	rules, err := service.ParseRules([]byte(`
+rules:
+  - when: {event: unit-added, application: mysql}
+    then:
+      - workload: {status: maintenance, message: installing}
+      - after: 100ms
+        workload: {status: active, message: ready}
+`))
+	c.Assert(err, gc.IsNil)
+	s.service.SetRules(rules)
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.BackingState.StartSync()
+
+	// The reactions are part of the install sequence, so the unit only
+	// becomes active once they have been played.
+	condition, err := service.ParseCondition("unit mysql/0 workload=active")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+	info := params.Unit{}
+	c.Assert(result.Decode(&info), gc.IsNil)
+	c.Check(info.WorkloadStatus.Message, gc.Equals, "ready")
+	c.Check(info.AgentStatus.Status, gc.Equals, "idle")
+}
+
+// Applications removed while the watch loop runs are ignored by the rules.
+func (s *FakeJujuServiceSuite) TestRulesApplicationRemoved(c *gc.C) {
+	rules, err := service.ParseRules([]byte(`
+rules:
+  - when: {event: config-changed, application: mysql, key: foo}
+    then:
+      - workload: {status: blocked}
+`))
+	c.Assert(err, gc.IsNil)
+	s.service.SetRules(rules)
+	s.service.Start()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.BackingState.StartSync()
+	condition, err := service.ParseCondition("unit mysql/0 agent=idle")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+
+	// The application goes away along with its last unit, possibly
+	// before the deltas about it are handled.
+	c.Assert(application.Destroy(), gc.IsNil)
+	s.BackingState.StartSync()
+	s.waitRemoved(c, application)
+
+	c.Assert(s.service.Stop(), gc.IsNil)
+}
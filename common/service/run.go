@@ -4,14 +4,20 @@ package service
 
 import (
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
+	"github.com/juju/errors"
 	"github.com/juju/loggo"
-	gc "gopkg.in/check.v1"
+	"github.com/juju/utils"
+	"gopkg.in/juju/names.v2"
 
+	"github.com/juju/juju/api/fakejuju/params"
 	"github.com/juju/juju/provider/dummy"
 
 	coretesting "github.com/juju/juju/testing"
@@ -20,20 +26,19 @@ import (
 
 // Main entry point for running the fake-juju service. It will:
 //
-// - Create FakeJujuSuite instance with suitable parameters (yes, a
-//   gocheck test suite, see its docstring). Its role is to set up
-//   and tear down a controller backed by the "dummy" provider (see
-//   the github.com/juju/juju/provider/dummy package).
+// - Create a ControllerLifecycle instance with suitable parameters. Its
+//   role is to set up and tear down a controller backed by the "dummy"
+//   provider (see the github.com/juju/juju/provider/dummy package).
 //
 // - Start an HTTP server serving a "control plane" API for
 //   controlling fake-juju itself.
 //
-// - When a 'bootstrap' request is received by the control plane API, kick
-//   off a run of our FakeJujuSuite instance, which will in turn create a
-//   new controller and start a juju API server for it.
+// - When a 'bootstrap' request is received by the control plane API,
+//   bootstrap a new controller through the ControllerLifecycle, which will
+//   in turn start a juju API server for it.
 //
-// - When a 'destroy' request is received by the control plan API, terminate
-//   the FakeJujuSuite, which will stop the API server and clear the database
+// - When a 'destroy' request is received by the control plan API, destroy
+//   the controller, which will stop the API server and clear the database
 //   state.
 //
 // Additional control plane API endpoints can be used to further control
@@ -47,8 +52,25 @@ func RunFakeJuju() int {
 	port := flags.Int("port", 17099, "The port the API server will listent to")
 	series := flags.String("series", "xenial", "Ubuntu series")
 	debug := flags.Bool("debug", false, "Enable debug logging")
+	manual := flags.Bool("manual", false, "Don't transition entities automatically, wait for control plane requests")
+	machineLatency := flags.Duration("machine-latency", 0, "Delay before starting a pending machine")
+	unitLatency := flags.Duration("unit-latency", 0, "Delay before starting an allocating unit")
+	actionLatency := flags.Duration("action-latency", 0, "Delay before completing a pending action")
+	removalLatency := flags.Duration("removal-latency", 0, "Delay before removing a dying unit or machine")
+	jitter := flags.Duration("latency-jitter", 0, "Maximum random delay added to the latencies above")
+	scenarioPath := flags.String("scenario", "", "Optional YAML scenario file to play once the controller is bootstrapped")
+	installPath := flags.String("install-sequence", "", "Optional YAML file with the status changes that units go through when started")
+	installDelay := flags.Duration("install-step-delay", 0, "Delay between the steps of the default install sequence")
+	rulesPath := flags.String("rules", "", "Optional YAML file with rules describing how units react to changes")
+	randomCert := flags.Bool("random-cert", false, "Use a randomly generated CA and certificate for the API server")
+	controllerUUID := flags.String("controller-uuid", "", "Optional UUID of the controller")
 	flags.Parse(os.Args[1:])
 
+	if *controllerUUID != "" && !utils.IsValidUUIDString(*controllerUUID) {
+		fmt.Fprintf(os.Stderr, "error: invalid controller UUID %q\n", *controllerUUID)
+		return 1
+	}
+
 	level := loggo.INFO
 	if *debug {
 		level = loggo.DEBUG
@@ -59,47 +81,140 @@ func RunFakeJuju() int {
 		Mongo:  *mongo,
 		Level:  level,
 		Port:   *port,
+		Manual: *manual,
+
+		UseRandomCert:  *randomCert,
+		ControllerUUID: *controllerUUID,
+
+		// Named controllers are hosted by child processes running
+		// this same binary, with the same options.
+		ControllerCommand: append([]string{"/proc/self/exe"}, os.Args[1:]...),
+		Latencies: params.Latencies{
+			Machine: params.Latency{Delay: *machineLatency, Jitter: *jitter},
+			Unit:    params.Latency{Delay: *unitLatency, Jitter: *jitter},
+			Action:  params.Latency{Delay: *actionLatency, Jitter: *jitter},
+			Removal: params.Latency{Delay: *removalLatency, Jitter: *jitter},
+		},
+	}
+
+	if *scenarioPath != "" {
+		scenario, err := readScenario(*scenarioPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			return 1
+		}
+		options.Scenario = scenario
+	}
+	if *installPath != "" {
+		steps, err := readInstallSequence(*installPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			return 1
+		}
+		options.InstallSequence = steps
+	} else {
+		options.InstallSequence = DefaultInstallSequence(*installDelay)
+	}
+	if *rulesPath != "" {
+		rules, err := readRules(*rulesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			return 1
+		}
+		options.Rules = rules
 	}
 
 	runner := NewFakeJujuRunner(options)
 	runner.Run()
-	result := runner.Wait()
-
-	if result.Succeeded == 1 {
-		return 0
-	} else {
+	if err := runner.Wait(); err != nil {
 		return 1
 	}
+	return 0
+}
+
+// Read and parse the scenario file at the given path.
+func readScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenario(data)
+}
+
+// Read and parse the install sequence file at the given path.
+func readInstallSequence(path string) ([]*StatusStep, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseInstallSequence(data)
+}
+
+// Read and parse the rules file at the given path.
+func readRules(path string) (*Rules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
 }
 
 func NewFakeJujuRunner(options *FakeJujuOptions) *FakeJujuRunner {
 	return &FakeJujuRunner{
-		options:  options,
-		commands: make(chan *command, 1),
-		result:   make(chan *gc.Result, 1),
+		options:   options,
+		lifecycle: NewControllerLifecycle(options),
+		commands:  make(chan *command, 1),
+		result:    make(chan error, 1),
+
+		failures:      newFailureRegistry(),
+		actionResults: newActionResultRegistry(),
+		controllers:   make(map[string]*namedController),
 	}
 }
 
 type FakeJujuRunner struct {
-	options *FakeJujuOptions
+	options   *FakeJujuOptions
+	lifecycle *ControllerLifecycle
 
 	// Control channel for sending commands to the main loop, for example
 	// the "bootstrap" command will trigger new iterations in the main
 	// loop (i.e. a new "bootstrap" process).
 	commands chan *command
 
-	// Channel for signalling that the main loop has terminated
-	result chan *gc.Result
+	// Channel for signalling that the main loop has terminated, it will
+	// be sent nil or the error that made the main loop terminate.
+	result chan error
 
 	// Control plane API port listener
 	listener net.Listener
+
+	// The FakeJujuService of the currently bootstrapped controller, or
+	// nil if no controller is bootstrapped. It's read by control plane
+	// API handlers, so access is serialized with the mutex below, which
+	// also protects the watch loop error.
+	service  *FakeJujuService
+	watchErr error
+	mutex    sync.Mutex
+
+	// The failures and action results of the bootstrapped controller or,
+	// if there's none, the ones registered for the next controller to
+	// bootstrap, which will be handed over to its FakeJujuService. Also
+	// protected by the mutex above.
+	failures      *failureRegistry
+	actionResults *actionResultRegistry
+
+	// Named controllers hosted by child processes, keyed by name (see
+	// controllers.go). Access is serialized with their own mutex, which
+	// is held while a child process starts.
+	controllers      map[string]*namedController
+	controllersMutex sync.Mutex
 }
 
 // Perform some setup tasks (logging, mongo, control plane API) and
 // then start the main loop in a goroutine. The main loop (or the
 // setup phase, in case of problems) will signal termination via the
-// FakeJujuRunner.result channel, which will be sent a *gc.Result with
-// information about whether the service completed cleanly or not.
+// FakeJujuRunner.result channel, which will be sent nil if the service
+// completed cleanly, or an error otherwise.
 //
 // Consumer code will then typically invoke FakeJujuRunner.Wait() to
 // wait for the main loop to terminate and gather such exit result.
@@ -113,11 +228,16 @@ func (f *FakeJujuRunner) Run() {
 	// randomly generated test certificate).
 	if !f.options.UseRandomCert {
 		if err := coretesting.SetCerts(); err != nil {
-			f.result <- &gc.Result{RunError: err}
+			f.result <- err
 			return
 		}
 	}
 
+	// The juju testing facilities bootstrap controllers with this tag.
+	if f.options.ControllerUUID != "" {
+		coretesting.ControllerTag = names.NewControllerTag(f.options.ControllerUUID)
+	}
+
 	if f.options.Mongo > 0 { // Use an external MongoDB instance
 		log.Infof("Using external MongoDB on port %d", f.options.Mongo)
 
@@ -133,29 +253,24 @@ func (f *FakeJujuRunner) Run() {
 
 		err := jujutesting.MgoServer.Start(coretesting.Certs)
 		if err != nil {
-			f.result <- &gc.Result{RunError: err}
+			f.result <- err
 			return
 		}
 	}
 
 	// Configure the test API server to listen to this port (the server
-	// will be started only at "bootstrap" time, see TestMainLoop()).
+	// will be started only at "bootstrap" time, see mainLoop()).
 	dummy.SetAPIPort(f.options.Port)
 
 	// Start the control-plane API
 	if err := f.serveControlPlaneAPI(); err != nil {
-		f.result <- &gc.Result{RunError: err}
+		f.result <- err
 		return
 	}
 
 	// Start the main loop, waiting for 'bootstrap' commands
-	conf := &gc.RunConf{
-		Output: os.Stdout,
-		Filter: "TestMainLoop",
-	}
-
 	go func() {
-		result := gc.Run(f, conf)
+		err := f.mainLoop()
 
 		if f.options.Mongo == 0 {
 			// Shutdown our dedicated MongoDB instance child
@@ -168,28 +283,34 @@ func (f *FakeJujuRunner) Run() {
 			f.stopControlPlaneAPI()
 		}
 
-		f.result <- result
+		f.result <- err
 	}()
 }
 
-// Main control loop of the fake-jujud service. It's prefixed with "Test"
-// only because we need to convince the gocheck package that this is
-// a test method, and thus have it invoked with a reference to a gc.C
-// instance (that we'll use to setup/teardown our FakeJujuSuite instance).
-func (f *FakeJujuRunner) TestMainLoop(c *gc.C) {
+// Main control loop of the fake-jujud service, processing commands until
+// a stop command or a signal is received, or a controller fails to
+// bootstrap.
+func (f *FakeJujuRunner) mainLoop() error {
 
 	log.Infof("Starting main loop")
 
 	terminate := make(chan os.Signal, 2)
 	signal.Notify(terminate, os.Interrupt, syscall.SIGTERM)
-
-	suite := &FakeJujuSuite{
-		options: f.options,
+	defer signal.Stop(terminate)
+
+	if err := f.lifecycle.SetUp(); err != nil {
+		log.Errorf("Setup error: %s", err.Error())
+		// Terminate the background gocheck test, which might still
+		// be waiting for lifecycle steps.
+		if err := f.lifecycle.TearDown(); err != nil {
+			log.Errorf("Teardown error: %s", err.Error())
+		}
+		return err
 	}
-	suite.SetUpSuite(c)
 
 	// Process commands, typically coming from the control plane API.
-	for {
+	var failure error
+	for failure == nil {
 		stop := false
 
 		var err error
@@ -211,11 +332,27 @@ func (f *FakeJujuRunner) TestMainLoop(c *gc.C) {
 			stop = true
 		} else if command.code == commandCodeBootstrap {
 			log.Infof("Bootstrapping fake controller")
-			suite.SetUpTest(c)
-			go f.monitorWatchLoop(suite)
+			err = f.lifecycle.bootstrap(f.getFailures(), f.getActionResults())
+			if errors.IsAlreadyExists(err) || errors.IsNotProvisioned(err) {
+				// Either the running controller is untouched,
+				// or the new one was torn down cleanly. Just
+				// report the error back.
+				log.Errorf("Bootstrap error: %s", err.Error())
+			} else if err != nil {
+				// The controller is in an unknown state, bail out.
+				log.Errorf("Bootstrap error: %s", err.Error())
+				failure = err
+			} else {
+				service := f.lifecycle.Service()
+				f.setService(service)
+				go f.monitorWatchLoop(service)
+			}
 		} else if command.code == commandCodeDestroy {
 			log.Infof("Destroying fake controller")
-			suite.TearDownTest(c)
+			f.setService(nil)
+			if err = f.lifecycle.Destroy(); err != nil {
+				log.Errorf("Destroy error: %s", err.Error())
+			}
 		}
 		command.done <- err
 
@@ -224,14 +361,24 @@ func (f *FakeJujuRunner) TestMainLoop(c *gc.C) {
 		}
 	}
 
-	if isControllerBootstrapped(suite) {
-		// This means that we didn't have chance to tear down the test
-		// because either the destroy command was not invoked or we
-		// got interrupted by a signal. Let's force a clean up.
-		suite.TearDownTest(c)
+	// This will destroy the controller if we didn't have chance to do it
+	// because either the destroy command was not invoked or we got
+	// interrupted by a signal. Named controllers go away too.
+	f.stopControllers()
+	f.setService(nil)
+	if err := f.lifecycle.TearDown(); err != nil {
+		log.Errorf("Teardown error: %s", err.Error())
+		if failure == nil {
+			failure = err
+		}
 	}
 
-	suite.TearDownSuite(c)
+	if failure == nil {
+		f.mutex.Lock()
+		failure = f.watchErr
+		f.mutex.Unlock()
+	}
+	return failure
 }
 
 // Stop the main loop.
@@ -239,25 +386,67 @@ func (f *FakeJujuRunner) Stop() {
 	f.commands <- newCommand(commandCodeStop)
 }
 
-// Wait for the main loop to complete and return the result.
-func (f *FakeJujuRunner) Wait() *gc.Result {
-	result := <-f.result
-	logResult(result)
-	return result
+// Wait for the main loop to complete and return its error, if any.
+func (f *FakeJujuRunner) Wait() error {
+	err := <-f.result
+	logResult(err)
+	return err
+}
+
+// Set the FakeJujuService of the currently bootstrapped controller. When
+// the controller goes away, so do its failures and action results.
+func (f *FakeJujuRunner) setService(service *FakeJujuService) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if service == nil && f.service != nil {
+		f.failures = newFailureRegistry()
+		f.actionResults = newActionResultRegistry()
+	}
+	f.service = service
+}
+
+// Return the FakeJujuService of the currently bootstrapped controller, or
+// an error if no controller is bootstrapped.
+func (f *FakeJujuRunner) getService() (*FakeJujuService, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.service == nil {
+		return nil, errors.New("controller not bootstrapped")
+	}
+	return f.service, nil
+}
+
+// Return the failures of the bootstrapped controller, or the ones
+// registered for the next controller to bootstrap.
+func (f *FakeJujuRunner) getFailures() *failureRegistry {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.failures
+}
+
+// Return the action results of the bootstrapped controller, or the ones
+// registered for the next controller to bootstrap.
+func (f *FakeJujuRunner) getActionResults() *actionResultRegistry {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.actionResults
 }
 
 // Monitor the watch loop of FakeJujuService and catch unexpected
 // errors.  If anything bad happens, we'll bail out. Otherwise, this
 // goroutine will silently terminate when the delta watch loop in
 // FakeJujuService gets stopped.
-func (f *FakeJujuRunner) monitorWatchLoop(suite *FakeJujuSuite) {
+func (f *FakeJujuRunner) monitorWatchLoop(service *FakeJujuService) {
 
 	// Here we block until the watch loop terminates, either
 	// successfully or not.
-	err := suite.Wait()
+	err := service.Wait()
 
 	if err != nil {
 		log.Errorf("Watch loop error: %s", err.Error())
+		f.mutex.Lock()
+		f.watchErr = err
+		f.mutex.Unlock()
 		f.Stop()
 	} else {
 		log.Infof("Stop monitoring watch loop")
@@ -265,17 +454,10 @@ func (f *FakeJujuRunner) monitorWatchLoop(suite *FakeJujuSuite) {
 }
 
 // Log a summary of the service run
-func logResult(result *gc.Result) {
-	if !(result.Succeeded == 1) {
-		log.Infof("Service finished uncleanly: %s", result.String())
+func logResult(err error) {
+	if err != nil {
+		log.Infof("Service finished uncleanly: %s", err.Error())
 	} else {
 		log.Infof("Service finished cleanly")
 	}
 }
-
-// Whether the dummy controller created by FakeJujuSuite has been bootstrapped.
-func isControllerBootstrapped(suite *FakeJujuSuite) bool {
-	// Use the presence of the RootDir has a flag indicating that the
-	// suite setup has run.
-	return suite.RootDir != ""
-}
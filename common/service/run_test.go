@@ -2,11 +2,16 @@ package service_test
 
 import (
 	"bytes"
+	"net/http"
 	"strings"
+	"time"
 
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/juju/api"
+	"github.com/juju/juju/api/fakejuju"
+	"github.com/juju/juju/api/fakejuju/params"
+	jujutesting "github.com/juju/juju/testing"
 	"github.com/juju/loggo"
 	"github.com/juju/testing"
 
@@ -40,11 +45,7 @@ func (s *FakeJujuRunnerSuite) SetUpTest(c *gc.C) {
 func (s *FakeJujuRunnerSuite) TestRun(c *gc.C) {
 	s.runner.Run()
 	s.runner.Stop()
-	result := s.runner.Wait()
-
-	c.Assert(result.String(), gc.Equals, "OK: 1 passed")
-	c.Assert(result.Succeeded, gc.Equals, 1)
-	c.Assert(result.RunError, gc.IsNil)
+	c.Assert(s.runner.Wait(), gc.IsNil)
 	c.Assert(
 		strings.Contains(s.output.String(), "Starting service"), gc.Equals, true)
 }
@@ -64,4 +65,105 @@ func (s *FakeJujuRunnerSuite) TestBootstrapAPI(c *gc.C) {
 	}
 }
 
+// The fakejuju client can drive the control plane API of a bootstrapped
+// controller.
+func (s *FakeJujuRunnerSuite) TestControlPlaneClient(c *gc.C) {
+	s.runner.Run()
+	defer s.runner.Wait()
+	defer s.runner.Stop()
+
+	client := fakejuju.NewClientWithPort(12346)
+
+	// Inspection endpoints require a bootstrapped controller.
+	_, err := client.Machines()
+	c.Assert(err, gc.ErrorMatches, "Failed fake-juju request: controller not bootstrapped")
+
+	// Action results can be registered before bootstrap.
+	c.Assert(client.SetActionResult(params.ActionResult{Action: "backup"}), gc.IsNil)
+
+	c.Assert(client.Bootstrap(), gc.IsNil)
+
+	results, err := client.ActionResults()
+	c.Assert(err, gc.IsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Check(results[0].Action, gc.Equals, "backup")
+
+	result, err := client.Wait("machine 0 status=started", jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	machine := params.Machine{}
+	c.Assert(result.Decode(&machine), gc.IsNil)
+	c.Check(machine.InstanceId, gc.Equals, "id-1")
+
+	machines, err := client.Machines()
+	c.Assert(err, gc.IsNil)
+	c.Check(machines, gc.HasLen, 1)
+
+	c.Assert(client.Fail("unit-mysql-0", params.Failure{Hook: "install"}), gc.IsNil)
+	failures, err := client.Failures()
+	c.Assert(err, gc.IsNil)
+	c.Assert(failures, gc.HasLen, 1)
+	c.Check(failures[0].Entity, gc.Equals, "unit-mysql-0")
+	c.Check(failures[0].Model, gc.Not(gc.Equals), "")
+	c.Check(failures[0].Hook, gc.Equals, "install")
+
+	err = client.RemoveFailure("unit-mysql-1")
+	c.Check(fakejuju.IsNotFound(err), gc.Equals, true)
+
+	_, err = client.Wait("machine 1 status=started", 100*time.Millisecond)
+	c.Check(fakejuju.IsTimeout(err), gc.Equals, true)
+
+	// Bootstrapping again is a conflict, which leaves the controller
+	// running.
+	err = client.Bootstrap()
+	c.Assert(err, gc.ErrorMatches, "Failed fake-juju request: controller already bootstrapped")
+	c.Check(err.(*fakejuju.Error).StatusCode, gc.Equals, http.StatusConflict)
+	_, err = client.Machines()
+	c.Check(err, gc.IsNil)
+
+	c.Assert(client.Destroy(), gc.IsNil)
+}
+
+// Failures can be scheduled before bootstrap. If the controller machine
+// is scheduled to fail, bootstrapping fails without terminating the
+// runner, and can be retried once the failure is removed.
+func (s *FakeJujuRunnerSuite) TestFailControllerMachine(c *gc.C) {
+	s.runner.Run()
+	defer s.runner.Wait()
+	defer s.runner.Stop()
+
+	client := fakejuju.NewClientWithPort(12346)
+	failure := params.Failure{Message: "no matching tools available"}
+	c.Assert(client.Fail("machine-0", failure), gc.IsNil)
+	failures, err := client.Failures()
+	c.Assert(err, gc.IsNil)
+	c.Assert(failures, gc.HasLen, 1)
+	c.Check(failures[0].Entity, gc.Equals, "machine-0")
+
+	err = client.Bootstrap()
+	c.Assert(err, gc.ErrorMatches, "Failed fake-juju request: controller machine failed: no matching tools available")
+
+	c.Assert(client.RemoveFailure("machine-0"), gc.IsNil)
+	c.Assert(client.Bootstrap(), gc.IsNil)
+	c.Assert(client.Destroy(), gc.IsNil)
+}
+
+// Named controllers are hosted by child processes, which can't be spawned
+// when the command line is not known.
+func (s *FakeJujuRunnerSuite) TestNamedControllers(c *gc.C) {
+	s.runner.Run()
+	defer s.runner.Wait()
+	defer s.runner.Stop()
+
+	client := fakejuju.NewClientWithPort(12346)
+	controllers, err := client.Controllers()
+	c.Assert(err, gc.IsNil)
+	c.Check(controllers, gc.HasLen, 0)
+
+	_, err = client.Controller("foo").Units()
+	c.Check(fakejuju.IsNotFound(err), gc.Equals, true)
+
+	err = client.Controller("foo").Bootstrap()
+	c.Check(err, gc.ErrorMatches, "Failed fake-juju request: named controllers not supported")
+}
+
 var _ = gc.Suite(&FakeJujuRunnerSuite{})
@@ -0,0 +1,293 @@
+// Replay timed events described by YAML scenario files
+
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"gopkg.in/juju/names.v2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state/multiwatcher"
+)
+
+// A list of events to be applied at given times after the scenario
+// starts. For example:
+//
+//   events:
+//     - at: 5s
+//       set-unit-status:
+//         unit: mysql/0
+//         workload: {status: blocked, message: waiting for storage}
+//     - at: 10s
+//       fail: {entity: machine-2, message: no matching tools available}
+//     - at: 20s
+//       complete-action: {id: "4", status: failed, message: disk full}
+//     - at: 30s
+//       model: deadbeef-0bad-400d-8000-4b1d0d06f00e
+//       start-machine: "1"
+type Scenario struct {
+	Events []*ScenarioEvent `yaml:"events"`
+}
+
+// An event of a scenario. Exactly one of the operation fields must be set.
+type ScenarioEvent struct {
+
+	// When the event should be applied, as a duration relative to the
+	// start of the scenario, optionally prefixed by "t+" (e.g. "t+5s").
+	At string `yaml:"at"`
+
+	// The UUID of the model that the event applies to. If empty, the
+	// controller model will be used. For failures, it can also be given
+	// in the failure details.
+	Model string `yaml:"model,omitempty"`
+
+	// Set the agent and/or workload status of a unit.
+	SetUnitStatus *UnitStatusEvent `yaml:"set-unit-status,omitempty"`
+
+	// Schedule an entity to fail, and fail it right away if it's in a
+	// state where failures apply (pending machines, units that are not
+	// allocating).
+	Fail *params.Failure `yaml:"fail,omitempty"`
+
+	// Complete a pending action.
+	CompleteAction *CompleteActionEvent `yaml:"complete-action,omitempty"`
+
+	// Start a pending machine or an allocating unit, given its ID or
+	// name. This is typically used in manual mode.
+	StartMachine string `yaml:"start-machine,omitempty"`
+	StartUnit    string `yaml:"start-unit,omitempty"`
+}
+
+// Details of a set-unit-status scenario event. A nil status is left
+// unchanged.
+type UnitStatusEvent struct {
+	Unit     string         `yaml:"unit"`
+	Agent    *params.Status `yaml:"agent,omitempty"`
+	Workload *params.Status `yaml:"workload,omitempty"`
+}
+
+// Details of a complete-action scenario event.
+type CompleteActionEvent struct {
+	Id      string                 `yaml:"id"`
+	Status  string                 `yaml:"status,omitempty"`
+	Results map[string]interface{} `yaml:"results,omitempty"`
+	Message string                 `yaml:"message,omitempty"`
+}
+
+// Parse and validate a YAML scenario.
+func ParseScenario(data []byte) (*Scenario, error) {
+	scenario := &Scenario{}
+	if err := yaml.Unmarshal(data, scenario); err != nil {
+		return nil, errors.Annotate(err, "cannot parse scenario")
+	}
+	for i, event := range scenario.Events {
+		if err := event.validate(); err != nil {
+			return nil, errors.Annotatef(err, "event %d", i)
+		}
+		event.normalize()
+	}
+	return scenario, nil
+}
+
+// Check that the event is well-formed.
+func (e *ScenarioEvent) validate() error {
+	if e == nil {
+		return errors.NotValidf("empty event")
+	}
+	if _, err := e.delay(); err != nil {
+		return errors.NotValidf("time %q", e.At)
+	}
+
+	operations := 0
+	if e.SetUnitStatus != nil {
+		operations++
+		if !names.IsValidUnit(e.SetUnitStatus.Unit) {
+			return errors.NotValidf("unit name %q", e.SetUnitStatus.Unit)
+		}
+	}
+	if e.Fail != nil {
+		operations++
+		if _, err := names.ParseTag(e.Fail.Entity); err != nil {
+			return errors.NotValidf("entity %q", e.Fail.Entity)
+		}
+		if err := e.Fail.Validate(); err != nil {
+			return err
+		}
+	}
+	if e.CompleteAction != nil {
+		operations++
+		if err := e.CompleteAction.result().ValidateStatus(); err != nil {
+			return err
+		}
+	}
+	if e.StartMachine != "" {
+		operations++
+	}
+	if e.StartUnit != "" {
+		operations++
+	}
+	if operations != 1 {
+		return errors.NotValidf("event with %d operations", operations)
+	}
+	return nil
+}
+
+// Convert the maps decoded from YAML, which have interface{} keys, to
+// maps with string keys, that can be stored in the database.
+func (e *ScenarioEvent) normalize() {
+	if e.SetUnitStatus != nil {
+		for _, info := range []*params.Status{e.SetUnitStatus.Agent, e.SetUnitStatus.Workload} {
+			if info != nil {
+				info.Data = normalizeYAMLMap(info.Data)
+			}
+		}
+	}
+	if e.Fail != nil {
+		e.Fail.Data = normalizeYAMLMap(e.Fail.Data)
+	}
+	if e.CompleteAction != nil {
+		e.CompleteAction.Results = normalizeYAMLMap(e.CompleteAction.Results)
+	}
+}
+
+// The time at which the event should be applied, relative to the start of
+// the scenario.
+func (e *ScenarioEvent) delay() (time.Duration, error) {
+	return time.ParseDuration(strings.TrimPrefix(e.At, "t+"))
+}
+
+// The action result to complete the action with.
+func (e *CompleteActionEvent) result() *params.ActionResult {
+	return &params.ActionResult{
+		Status:  e.Status,
+		Results: e.Results,
+		Message: e.Message,
+	}
+}
+
+// Start playing the given scenario, replacing the one currently playing
+// (if any). Events are applied in the background, and errors are logged.
+// The scenario stops when the service gets stopped or reset.
+func (s *FakeJujuService) PlayScenario(scenario *Scenario) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stopScenario()
+
+	log.Infof("Playing scenario with %d events", len(scenario.Events))
+	for _, event := range scenario.Events {
+		event := event
+		delay, _ := event.delay() // Validated by ParseScenario
+		timer := time.AfterFunc(delay, func() {
+			s.applyScenarioEvent(event)
+		})
+		s.scenarioTimers = append(s.scenarioTimers, timer)
+	}
+}
+
+// Stop playing the current scenario, if any.
+func (s *FakeJujuService) StopScenario() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stopScenario()
+}
+
+// Cancel the pending events of the current scenario.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) stopScenario() {
+	for _, timer := range s.scenarioTimers {
+		timer.Stop()
+	}
+	s.scenarioTimers = nil
+}
+
+// Apply a scenario event, logging any error.
+func (s *FakeJujuService) applyScenarioEvent(event *ScenarioEvent) {
+	s.lock.Lock()
+	stopped := s.stopped
+	s.lock.Unlock()
+	if stopped {
+		return
+	}
+
+	log.Infof("Applying scenario event at %s", event.At)
+
+	var err error
+	switch {
+	case event.SetUnitStatus != nil:
+		e := event.SetUnitStatus
+		err = s.SetUnitStatus(event.Model, e.Unit, e.Agent, e.Workload)
+	case event.Fail != nil:
+		err = s.applyScenarioFailure(event.Model, event.Fail)
+	case event.CompleteAction != nil:
+		e := event.CompleteAction
+		err = s.CompleteAction(event.Model, e.Id, e.result())
+	case event.StartMachine != "":
+		err = s.StartMachine(event.Model, event.StartMachine)
+	case event.StartUnit != "":
+		err = s.StartUnit(event.Model, event.StartUnit)
+	}
+	if err != nil {
+		log.Errorf("Scenario event at %s failed: %s", event.At, err.Error())
+	}
+}
+
+// Schedule the given failure, and handle the entity again so that the
+// failure is applied right away if possible. The failure applies to the
+// model with the given UUID, unless it specifies its own model.
+func (s *FakeJujuService) applyScenarioFailure(model string, failure *params.Failure) error {
+	tag, err := names.ParseTag(failure.Entity)
+	if err != nil {
+		return err
+	}
+	stored := *failure
+	if stored.Model == "" {
+		stored.Model = model
+	}
+	s.SetFailure(failure.Entity, &stored)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.handleEntityChanged(multiwatcher.EntityId{
+		Kind:      tag.Kind(),
+		ModelUUID: stored.Model,
+		Id:        tag.Id(),
+	})
+}
+
+// Recursively convert map[interface{}]interface{} values to
+// map[string]interface{} ones.
+func normalizeYAMLMap(value map[string]interface{}) map[string]interface{} {
+	if value == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(value))
+	for key, item := range value {
+		result[key] = normalizeYAMLValue(item)
+	}
+	return result
+}
+
+func normalizeYAMLValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[fmt.Sprint(key)] = normalizeYAMLValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = normalizeYAMLValue(item)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,135 @@
+package service_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+	"github.com/juju/juju/testing/factory"
+
+	"../service"
+)
+
+// Scenarios are parsed from YAML and validated.
+func (s *FakeJujuServiceSuite) TestParseScenario(c *gc.C) {
+	scenario, err := service.ParseScenario([]byte(`
+events:
+  - at: t+5s
+    set-unit-status:
+      unit: mysql/0
+      workload: {status: blocked, message: waiting for storage}
+  - at: 10s
+    fail: {entity: machine-2}
+  - at: 20s
+    complete-action:
+      id: "4"
+      status: failed
+      results: {outcome: {code: 1}}
+  - at: 30s
+    model: deadbeef-0bad-400d-8000-4b1d0d06f00e
+    start-machine: "1"
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(scenario.Events, gc.HasLen, 4)
+	c.Check(scenario.Events[0].SetUnitStatus.Workload.Message, gc.Equals, "waiting for storage")
+	c.Check(scenario.Events[0].Model, gc.Equals, "")
+	c.Check(scenario.Events[1].Fail.Entity, gc.Equals, "machine-2")
+	c.Check(scenario.Events[3].Model, gc.Equals, "deadbeef-0bad-400d-8000-4b1d0d06f00e")
+	c.Check(scenario.Events[2].CompleteAction.Results, gc.DeepEquals, map[string]interface{}{
+		"outcome": map[string]interface{}{"code": 1},
+	})
+
+	_, err = service.ParseScenario([]byte("events: [{at: soon, start-machine: '1'}]"))
+	c.Check(err, gc.ErrorMatches, `event 0: time "soon" not valid`)
+	_, err = service.ParseScenario([]byte("events: [{at: 1s}]"))
+	c.Check(err, gc.ErrorMatches, `event 0: event with 0 operations not valid`)
+	_, err = service.ParseScenario([]byte("events: [{at: 1s, complete-action: {id: '1', status: running}}]"))
+	c.Check(err, gc.ErrorMatches, `event 0: action status "running" not valid`)
+}
+
+// Scenario events are applied against the backing state.
+func (s *FakeJujuServiceSuite) TestPlayScenario(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.BackingState.StartSync()
+
+	condition, err := service.ParseCondition("unit mysql/0 workload=active")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+
+	scenario, err := service.ParseScenario([]byte(`
+events:
+  - at: 100ms
+    set-unit-status:
+      unit: mysql/0
+      workload: {status: blocked, message: waiting for storage}
+`))
+	c.Assert(err, gc.IsNil)
+	s.service.PlayScenario(scenario)
+
+	condition, err = service.ParseCondition("unit mysql/0 workload=blocked")
+	c.Assert(err, gc.IsNil)
+	result, err = s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+	info := params.Unit{}
+	c.Assert(result.Decode(&info), gc.IsNil)
+	c.Check(info.WorkloadStatus.Message, gc.Equals, "waiting for storage")
+}
+
+// Scenario events can target a hosted model, given by UUID.
+func (s *FakeJujuServiceSuite) TestPlayScenarioHostedModel(c *gc.C) {
+	options := &service.FakeJujuOptions{
+		Mongo:  -1,
+		Series: "xenial",
+		Manual: true,
+	}
+	s.service = service.NewFakeJujuService(s.BackingState, s.APIState, options)
+	s.service.Start()
+	defer s.service.Stop()
+
+	st := s.Factory.MakeModel(c, nil)
+	defer st.Close()
+
+	machine, err := st.AddOneMachine(state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	st.StartSync()
+
+	scenario, err := service.ParseScenario([]byte(`
+events:
+  - at: 100ms
+    model: ` + st.ModelUUID() + `
+    start-machine: "` + machine.Id() + `"
+`))
+	c.Assert(err, gc.IsNil)
+	s.service.PlayScenario(scenario)
+
+	condition, err := service.ParseCondition("machine " + machine.Id() + " status=started")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor(st.ModelUUID(), condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+}
@@ -11,11 +11,14 @@ package service
 
 import (
 	"io"
+	"sync"
 	"time"
 
 	"github.com/juju/juju/api"
+	"github.com/juju/juju/api/fakejuju/params"
 	"github.com/juju/juju/state"
 	"github.com/juju/juju/state/multiwatcher"
+	"github.com/juju/juju/status"
 	"github.com/juju/loggo"
 	"github.com/juju/utils"
 )
@@ -37,26 +40,88 @@ type FakeJujuOptions struct {
 	Series string // Default Ubuntu series
 
 	// Whether to use a random certificate for the juju API server. This
-	// is set to true only by unit tests, where we want to leverage the
+	// is set to true by unit tests, where we want to leverage the
 	// custom certificate that JujuConnSuite generates, and that the
-	// rest of testing facilities execpt.
+	// rest of testing facilities execpt. It's also set for child
+	// processes hosting named controllers, so each gets its own CA.
 	UseRandomCert bool
 
+	// Optional UUID of the controller, instead of the fixed one used by
+	// the juju testing facilities.
+	ControllerUUID string
+
+	// The command line for spawning child fake-jujud processes that host
+	// named controllers (see controllers.go). If empty, named controllers
+	// are not supported.
+	ControllerCommand []string
+
 	// Whether to automatically start machines for units that don't appear
 	// to have one.
 	AutoStartMachines bool
+
+	// Whether to leave machines pending, units allocating and actions
+	// pending until they are explicitly transitioned through the control
+	// plane API. The controller machine is always started automatically.
+	Manual bool
+
+	// Initial delays for machine, unit and action transitions. They
+	// can be changed at runtime with FakeJujuService.SetLatencies.
+	Latencies params.Latencies
+
+	// Optional scenario to play once the controller is ready.
+	Scenario *Scenario
+
+	// The status changes that units go through when started. If empty,
+	// the default is DefaultInstallSequence(0).
+	InstallSequence []*StatusStep
+
+	// Initial rules describing how units react to changes. They can be
+	// changed at runtime with FakeJujuService.SetRules.
+	Rules *Rules
 }
 
 // The core fake-juju service
 func NewFakeJujuService(
 	state *state.State, api api.Connection, options *FakeJujuOptions) *FakeJujuService {
+	return newFakeJujuService(
+		state, api, options, newFailureRegistry(), newActionResultRegistry())
+}
+
+// Create a FakeJujuService using the given failures and action results,
+// which might have been registered through the control plane API before
+// bootstrap.
+func newFakeJujuService(
+	state *state.State, api api.Connection, options *FakeJujuOptions,
+	failures *failureRegistry, actionResults *actionResultRegistry) *FakeJujuService {
 
+	installSequence := options.InstallSequence
+	if len(installSequence) == 0 {
+		installSequence = DefaultInstallSequence(0)
+	}
+	failures.setControllerModel(state.ModelUUID())
 	return &FakeJujuService{
-		state:   state,
-		api:     api,
-		options: options,
-		ready:   make(chan error, 1),
-		done:    make(chan error, 1),
+		state:     state,
+		api:       api,
+		options:   options,
+		ready:     make(chan error, 1),
+		done:      make(chan error, 1),
+		latencies: options.Latencies,
+		rules:     options.Rules,
+		timers:    make(map[string]bool),
+		events:    newEventHub(),
+
+		installSequence: installSequence,
+		stepsTimers:     make(map[string][]*time.Timer),
+		instanceCounts:  make(map[string]int),
+
+		failures:         failures,
+		actionResults:    actionResults,
+		rulesConfigs:     make(map[string]map[string]interface{}),
+		descriptors:      make(map[string]*CharmDescriptor),
+		relationSettings: make(map[string]map[string]interface{}),
+		leaders:          make(map[string]string),
+		models:           make(map[string]*hostedModel),
+		modelsDone:       make(chan struct{}),
 	}
 }
 
@@ -70,8 +135,80 @@ type FakeJujuService struct {
 	options *FakeJujuOptions
 	watcher *state.Multiwatcher
 
-	// Monotonically incrementing counter for generating instance IDs.
-	instanceCount int
+	// Connection information for the juju API server, if known.
+	apiInfo *api.Info
+
+	// Serializes entity transitions, which happen both in the watch
+	// loop and in delayed transition timers (see latency.go). It also
+	// protects the fields below.
+	lock sync.Mutex
+
+	// Current latency settings.
+	latencies params.Latencies
+
+	// Monotonically incrementing counters for generating instance IDs,
+	// keyed by model UUID.
+	instanceCounts map[string]int
+
+	// Pending delayed transitions, keyed by entity and transition. The
+	// value is true if the delay has expired and the transition is due.
+	timers map[string]bool
+
+	// Whether the service was stopped, in which case pending delayed
+	// transitions are discarded.
+	stopped bool
+
+	// Publishes deltas and transitions to subscribers.
+	events *eventHub
+
+	// Entities scheduled to fail (see failures.go). It's safe for
+	// concurrent use on its own.
+	failures *failureRegistry
+
+	// Results that actions should complete with (see results.go). It's
+	// safe for concurrent use on its own.
+	actionResults *actionResultRegistry
+
+	// The status changes that units go through when started (see
+	// install.go).
+	installSequence []*StatusStep
+
+	// Timers of delayed status steps, keyed by model UUID and unit name
+	// (see steps.go).
+	stepsTimers map[string][]*time.Timer
+
+	// Current rules and the last seen application configurations, keyed
+	// by model UUID and application name (see rules.go).
+	rules        *Rules
+	rulesConfigs map[string]map[string]interface{}
+
+	// Cached charm descriptors, keyed by model UUID and charm URL. The
+	// value is nil for charms without a descriptor (see descriptor.go).
+	descriptors map[string]*CharmDescriptor
+
+	// Relation settings set through the control plane API, keyed by
+	// model UUID, relation ID and unit name (see relation.go).
+	relationSettings map[string]map[string]interface{}
+
+	// The units that hold or are taking over the leadership of their
+	// application, keyed by model UUID and application name (see
+	// leadership.go).
+	leaders map[string]string
+
+	// Timers for the pending events of the scenario being played (see
+	// scenario.go).
+	scenarioTimers []*time.Timer
+
+	// Hosted models being watched, keyed by UUID (see models.go).
+	models map[string]*hostedModel
+
+	// Watcher for models being added or removed, and a channel that
+	// will be closed when the models watch loop terminates.
+	modelsWatcher state.StringsWatcher
+	modelsDone    chan struct{}
+
+	// Tracks the watch loops of hosted models.
+	modelLoops sync.WaitGroup
 
 	// A channel that will be filled with nil if machine 0 could be
 	// started cleanly, or with an error otherwise.
@@ -122,22 +259,61 @@ func (s *FakeJujuService) Initialize() error {
 	return nil
 }
 
-// Start the service. It will watch for changes and react accordingly.
+// Start the service. It will watch for changes and react accordingly, both
+// in the controller model and in hosted models.
 func (s *FakeJujuService) Start() {
 	s.watcher = s.state.Watch()
+	s.modelsWatcher = s.state.WatchModels()
 	go s.watch()
+	go s.watchModels()
+	go s.renewLeadership()
+}
+
+// Return the connection information for the juju API server, including the
+// admin credentials.
+func (s *FakeJujuService) APIInfo() *api.Info {
+	return s.apiInfo
+}
+
+// Return the connection information for the controller.
+func (s *FakeJujuService) ControllerInfo() params.Controller {
+	return params.Controller{
+		ControllerUUID: s.state.ControllerUUID(),
+		ModelUUID:      s.apiInfo.ModelTag.Id(),
+		Addresses:      s.apiInfo.Addrs,
+		CACert:         s.apiInfo.CACert,
+		User:           s.apiInfo.Tag.Id(),
+		Password:       s.apiInfo.Password,
+	}
 }
 
 // Wait for the service to be ready, i.e. wait for machine 0 to transition
-// to the "started" state.
+// to the "started" state and for its agent presence to be observed.
 func (s *FakeJujuService) Ready() error {
-	return <-s.ready
+	if err := <-s.ready; err != nil {
+		return err
+	}
+	machine, err := s.state.Machine("0")
+	if err != nil {
+		return err
+	}
+	return machine.WaitAgentPresence(MediumWait)
 }
 
-// Stop the service, cancelling our delta watcher. This method will wait
-// for the watch loop to terminate, and return any error occurring while
+// Stop the service, cancelling our delta watchers. This method will wait
+// for the watch loops to terminate, and return any error occurring while
 // shutting down.
 func (s *FakeJujuService) Stop() error {
+	s.lock.Lock()
+	s.stopped = true
+	s.stopScenario()
+	s.lock.Unlock()
+
+	if err := s.modelsWatcher.Stop(); err != nil {
+		return err
+	}
+	<-s.modelsDone
+
 	if err := s.watcher.Stop(); err != nil {
 		return err
 	}
@@ -169,6 +345,7 @@ func (s *FakeJujuService) watch() {
 		}
 	}
 	log.Infof("Watch loop terminated")
+	s.events.close()
 
 	// This will unblock any caller of Wait(), and make it return "nil"
 	// to signal a clean termination.
@@ -177,26 +354,80 @@ func (s *FakeJujuService) watch() {
 
 // Handle an entity delta
 func (s *FakeJujuService) handleDelta(delta multiwatcher.Delta) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
 	entity := delta.Entity.EntityId()
 	log.Infof("Delta for %s-%s (removed: %t)", entity.Kind, entity.Id, delta.Removed)
+	s.publishDelta(delta)
 	if delta.Removed {
-		return nil
+		return s.handleEntityRemoved(entity)
 	} else {
 		return s.handleEntityChanged(entity)
 	}
 }
 
+// Handle a removed entity
+func (s *FakeJujuService) handleEntityRemoved(entity multiwatcher.EntityId) error {
+	st := s.modelState(entity.ModelUUID)
+	if st == nil {
+		return nil
+	}
+	switch entity.Kind {
+	case "unit":
+		return s.handleUnitRemoved(st, entity.Id)
+	}
+	return nil
+}
+
 // Handle a changed entity
 func (s *FakeJujuService) handleEntityChanged(entity multiwatcher.EntityId) error {
+	st := s.modelState(entity.ModelUUID)
+	if st == nil {
+		log.Infof("Ignoring entity of untracked model %s", entity.ModelUUID)
+		return nil
+	}
+
+	var err error
 	switch entity.Kind {
 	case "machine":
-		return s.handleMachineChanged(entity.Id)
+		err = s.handleMachineChanged(st, entity.Id)
 	case "unit":
-		return s.handleUnitChanged(entity.Id)
+		err = s.handleUnitChanged(st, entity.Id)
 	case "action":
-		return s.handleActionChanged(entity.Id)
+		err = s.handleActionChanged(st, entity.Id)
+	case "relation":
+		err = s.handleRelationChanged(st, entity.Id)
 	default:
 		log.Infof("Ignoring kind %s", entity.Kind)
-		return nil
+	}
+	if err == nil {
+		err = s.evaluateRules(st, entity)
+	}
+	return err
+}
+
+// Convert a juju status into its control plane API representation.
+func newStatus(info status.StatusInfo) params.Status {
+	return params.Status{
+		Status:  string(info.Status),
+		Message: info.Message,
+		Data:    info.Data,
+		Since:   info.Since,
+	}
+}
+
+// Convert a control plane API status into a juju status.
+func jujuStatusInfo(info *params.Status) status.StatusInfo {
+	since := info.Since
+	if since == nil {
+		now := time.Now()
+		since = &now
+	}
+	return status.StatusInfo{
+		Status:  status.Status(info.Status),
+		Message: info.Message,
+		Data:    info.Data,
+		Since:   since,
 	}
 }
@@ -0,0 +1,209 @@
+// Play sequences of unit status changes
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	"github.com/juju/juju/status"
+)
+
+// A step of a sequence of unit status changes, for example:
+//
+//   - workload: {status: maintenance, message: installing}
+//   - after: 3s
+//     workload: {status: active}
+type StatusStep struct {
+
+	// How long to wait after the previous step (or after the start of
+	// the sequence, for the first step), e.g. "3s". Empty means no wait.
+	After string `yaml:"after,omitempty"`
+
+	// The statuses to set. A nil status is left unchanged.
+	Agent    *params.Status `yaml:"agent,omitempty"`
+	Workload *params.Status `yaml:"workload,omitempty"`
+
+	// Whether an active workload status must be replaced by a blocked
+	// one if required relations are missing. This is only set on the
+	// final step of the install sequence (see startUnit).
+	checkRelations bool
+}
+
+// Check that the step is well-formed, and convert the status data decoded
+// from YAML to maps that can be stored in the database.
+func (step *StatusStep) validate() error {
+	if step == nil {
+		return errors.NotValidf("empty step")
+	}
+	if _, err := step.delay(); err != nil {
+		return errors.NotValidf("delay %q", step.After)
+	}
+	if step.Agent == nil && step.Workload == nil {
+		return errors.NotValidf("step without statuses")
+	}
+	for _, info := range []*params.Status{step.Agent, step.Workload} {
+		if info != nil {
+			info.Data = normalizeYAMLMap(info.Data)
+		}
+	}
+	return nil
+}
+
+// How long to wait before applying the step.
+func (step *StatusStep) delay() (time.Duration, error) {
+	if step.After == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(step.After)
+}
+
+// Check that all the given steps are well-formed.
+func validateStatusSteps(steps []*StatusStep) error {
+	for i, step := range steps {
+		if err := step.validate(); err != nil {
+			return errors.Annotatef(err, "step %d", i)
+		}
+	}
+	return nil
+}
+
+// Apply the given status steps to the unit with the given name in the
+// model of the given state. Steps without a delay are applied right away,
+// the others when their delay expires. Delayed steps are discarded if the
+// service gets stopped, or the unit gets removed or errors (for example
+// because of a scheduled failure). If not nil, the given function is
+// called once all the steps have been applied.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) playStatusSteps(st *state.State, name string, steps []*StatusStep, done func(*state.State) error) error {
+	for i, step := range steps {
+		delay, _ := step.delay() // Validated when loaded
+		if delay > 0 {
+			s.delayStatusSteps(st.ModelUUID(), name, delay, steps[i:], done)
+			return nil
+		}
+		if err := s.applyStatusStep(st, name, step); err != nil {
+			return err
+		}
+	}
+	if done != nil {
+		return done(st)
+	}
+	return nil
+}
+
+// Apply the statuses of the given step to the unit with the given name. If
+// the step requires it, an active workload status is replaced by a blocked
+// one if the unit's charm requires relations that are not established yet.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) applyStatusStep(st *state.State, name string, step *StatusStep) error {
+	workload := step.Workload
+	if step.checkRelations {
+		var err error
+		workload, err = missingRelationsStatus(st, name, workload)
+		if err != nil {
+			return err
+		}
+	}
+	return s.setUnitStatus(st, name, step.Agent, workload)
+}
+
+// Apply the first of the given steps after the given delay, and then the
+// remaining ones.
+func (s *FakeJujuService) delayStatusSteps(uuid, name string, delay time.Duration, steps []*StatusStep, done func(*state.State) error) {
+	log.Infof("Delaying status change of unit %s by %s", name, delay)
+	key := unitStepsKey(uuid, name)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.stopped || !s.removeStepsTimer(key, timer) {
+			return // Stopped, or cancelled by cancelStatusSteps
+		}
+		st := s.modelState(uuid)
+		if st == nil {
+			return
+		}
+		errored, err := unitErrored(st, name)
+		if err == nil && errored {
+			log.Infof("Unit %s errored, discarding status steps", name)
+			return
+		}
+		step := steps[0]
+		if err == nil {
+			err = s.applyStatusStep(st, name, step)
+		}
+		if err == nil {
+			err = s.playStatusSteps(st, name, steps[1:], done)
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			log.Errorf("Status step error: %s (unit %s)", err.Error(), name)
+		}
+	})
+	s.stepsTimers[key] = append(s.stepsTimers[key], timer)
+}
+
+// Cancel the delayed status steps of the unit with the given name in the
+// model with the given UUID, for example because the unit errored.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) cancelStatusSteps(uuid, name string) {
+	key := unitStepsKey(uuid, name)
+	if len(s.stepsTimers[key]) > 0 {
+		log.Infof("Cancelling status changes of unit %s", name)
+	}
+	for _, timer := range s.stepsTimers[key] {
+		timer.Stop()
+	}
+	delete(s.stepsTimers, key)
+}
+
+// Forget about the given timer of delayed status steps, returning false if
+// it was cancelled already.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) removeStepsTimer(key string, timer *time.Timer) bool {
+	timers := s.stepsTimers[key]
+	for i, t := range timers {
+		if t != timer {
+			continue
+		}
+		timers = append(timers[:i], timers[i+1:]...)
+		if len(timers) == 0 {
+			delete(s.stepsTimers, key)
+		} else {
+			s.stepsTimers[key] = timers
+		}
+		return true
+	}
+	return false
+}
+
+// The key of the delayed status steps of the given unit.
+func unitStepsKey(uuid, name string) string {
+	return fmt.Sprintf("%s:%s", uuid, name)
+}
+
+// Whether the agent or workload status of the unit with the given name is
+// error.
+func unitErrored(st *state.State, name string) (bool, error) {
+	unit, err := st.Unit(name)
+	if err != nil {
+		return false, err
+	}
+	agentStatus, err := unit.AgentStatus()
+	if err != nil {
+		return false, err
+	}
+	workloadStatus, err := unit.Status()
+	if err != nil {
+		return false, err
+	}
+	return agentStatus.Status == status.Error || workloadStatus.Status == status.Error, nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"github.com/juju/errors"
 	gc "gopkg.in/check.v1"
 	corecharm "gopkg.in/juju/charmrepo.v2-unstable"
 
@@ -15,7 +16,8 @@ import (
 // It's implemented as a gocheck test suite because that's the easiest way
 // to re-use all the code that sets up the dummy provider. Ideally such
 // logic should be factored out from testing-related tooling and be made
-// standalone.
+// standalone. Code outside of gocheck tests should use ControllerLifecycle,
+// which drives this suite and reports failures as errors.
 type FakeJujuSuite struct {
 	testing.JujuConnSuite
 
@@ -24,12 +26,21 @@ type FakeJujuSuite struct {
 }
 
 func (s *FakeJujuSuite) SetUpTest(c *gc.C) {
+	c.Assert(s.bootstrap(c, newFailureRegistry(), newActionResultRegistry()), gc.IsNil)
+}
+
+// Set up a new controller and start its FakeJujuService, with the given
+// failures and action results. If the controller machine fails to come up,
+// because it was scheduled to fail, the controller is torn down and a
+// NotProvisioned error is returned.
+func (s *FakeJujuSuite) bootstrap(c *gc.C, failures *failureRegistry, actionResults *actionResultRegistry) error {
 	log.Infof("Initializing fake-juju controller")
 	s.JujuConnSuite.SetUpTest(c)
 
 	s.PatchValue(&corecharm.CacheDir, c.MkDir())
 
-	s.service = NewFakeJujuService(s.BackingState, s.APIState, s.options)
+	s.service = newFakeJujuService(s.BackingState, s.APIState, s.options, failures, actionResults)
+	s.service.apiInfo = s.APIInfo(c)
 	err := s.service.Initialize()
 	c.Assert(err, jc.ErrorIsNil)
 
@@ -43,14 +54,23 @@ func (s *FakeJujuSuite) SetUpTest(c *gc.C) {
 	log.Infof("Starting fake-juju watch loop")
 	s.service.Start()
 	err = s.service.Ready()
+	if errors.IsNotProvisioned(err) {
+		log.Errorf("Tearing down fake-juju controller: %s", err.Error())
+		s.TearDownTest(c)
+		return err
+	}
 	c.Assert(err, gc.IsNil)
+
+	if s.options.Scenario != nil {
+		s.service.PlayScenario(s.options.Scenario)
+	}
+	return nil
 }
 
 func (s *FakeJujuSuite) TearDownTest(c *gc.C) {
 	log.Infof("Stopping fake-juju watch loop")
 
 	c.Assert(s.service.Stop(), gc.IsNil)
-	ClearFailures()
 	s.JujuConnSuite.TearDownTest(c)
 }
 
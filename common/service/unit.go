@@ -5,19 +5,31 @@ package service
 import (
 	"time"
 
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api/fakejuju/params"
 	"github.com/juju/juju/state"
 	"github.com/juju/juju/status"
 )
 
-// Handle a changed unit
-func (s *FakeJujuService) handleUnitChanged(id string) error {
+// Handle a changed unit in the model of the given state
+func (s *FakeJujuService) handleUnitChanged(st *state.State, id string) error {
 	log.Infof("Handling changed unit %s", id)
 
 	// Get the unit
-	unit, err := s.state.Unit(id)
+	unit, err := st.Unit(id)
+	if errors.IsNotFound(err) {
+		// The unit was removed in the meantime (for example by a
+		// reset), we'll get a delta about the removal.
+		log.Infof("Unit %s is gone", id)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	if unit.Life() != state.Alive {
+		return s.handleUnitDying(st, unit)
+	}
 
 	workloadStatus, err := unit.Status()
 	if err != nil {
@@ -30,78 +42,212 @@ func (s *FakeJujuService) handleUnitChanged(id string) error {
 	}
 
 	if agentStatus.Status == status.Allocating {
-		return s.startUnit(unit)
-	} else if workloadStatus.Status != status.Error && ShouldFail("unit", id) {
-		return s.errorUnit(unit)
+		if _, err := unit.AssignedMachineId(); err != nil {
+			if s.options.AutoStartMachines {
+				// If the unit has no machine assigned, we'll create one
+				// for it. We should eventually get another delta about
+				// the unit, and at that point this if branch won't be
+				// taken anymore, because there's an assigned machine.
+				return s.addMachineForUnit(st, unit)
+			} else {
+				// Just no-op, we'll retry as soon as the unit gets
+				// associated with a machine.
+				return nil
+			}
+		}
+		if s.options.Manual {
+			// The unit will be started by an explicit StartUnit call.
+			return nil
+		}
+		if !s.isDue(st, "start", "unit", id, unitLatency(s.latencies, unit.ApplicationName())) {
+			return nil
+		}
+		return s.startUnit(st, unit)
+	}
+
+	failure := s.getFailure(st, "unit", id)
+	if failure != nil && !failure.StuckDying && workloadStatus.Status != status.Error {
+		return s.errorUnit(st, unit, failure)
 	}
 
 	return nil
 }
 
-// Start a unit (i.e. transition it from waiting to active)
-func (s *FakeJujuService) startUnit(unit *state.Unit) error {
+// Start a unit (i.e. transition it from allocating to idle/active, going
+// through the install sequence). The first step of the sequence is applied
+// right away, the others possibly after a delay. The "start" transition is
+// published once the whole sequence has been applied.
+func (s *FakeJujuService) startUnit(st *state.State, unit *state.Unit) error {
 	log.Infof("Starting unit %s", unit.Name())
 
-	now := time.Now()
+	steps := s.installSequence
+	final := steps[len(steps)-1]
+	if descriptor := s.unitCharmDescriptor(st, unit); descriptor != nil {
+		s.applyCharmDescriptor(unit, descriptor)
+		// The charm status changes follow the install sequence.
+		steps = append(steps[:len(steps):len(steps)], descriptor.Status...)
+	}
+	steps = s.unitAddedSequence(unit.ApplicationName(), steps)
+	if n := len(steps) - 1; steps[n] == final {
+		// Nothing overrides the final status of the install sequence,
+		// so the unit is blocked if required relations are missing.
+		step := *final
+		step.checkRelations = true
+		steps = append(steps[:n:n], &step)
+	}
 
-	if _, err := unit.AssignedMachineId(); err != nil {
-		if s.options.AutoStartMachines {
-			// If the unit has no machine assigned, we'll create one
-			// for it. We should eventually get another delta about
-			// the unit, and at that point this if branch won't be
-			// taken anymore, because there's an assigned machine.
-			return s.addMachineForUnit(unit)
-		} else {
-			// Just no-op, we'll retry as soon as the unit gets
-			// associated with a machine.
-			return nil
-		}
+	if err := s.applyStatusStep(st, unit.Name(), steps[0]); err != nil {
+		return err
 	}
+	s.electLeader(st, unit)
 
-	if err := unit.SetAgentStatus(status.StatusInfo{
-		Status:  status.Idle,
-		Message: "",
-		Since:   &now,
-	}); err != nil {
+	if err := s.enterRelationScopes(st, unit); err != nil {
 		return err
 	}
 
-	if err := unit.SetStatus(status.StatusInfo{
-		Status:  status.Active,
-		Message: "",
-		Since:   &now,
-	}); err != nil {
+	return s.playStatusSteps(st, unit.Name(), steps[1:], func(st *state.State) error {
+		return s.publishUnitStarted(st, unit.Name())
+	})
+}
+
+// Publish the "start" transition of the unit with the given name, along
+// with its final workload status.
+func (s *FakeJujuService) publishUnitStarted(st *state.State, name string) error {
+	unit, err := st.Unit(name)
+	if err != nil {
 		return err
 	}
+	workloadStatus, err := unit.Status()
+	if err != nil {
+		return err
+	}
+	s.publishTransition("unit", name, "start", string(workloadStatus.Status))
+	return nil
+}
 
-	// Set agent presence
+// Set the presence of the unit agent, if not already alive. This doesn't
+// wait for the presence to be observed, since it's called with the service
+// lock held.
+func (s *FakeJujuService) setUnitAgentPresence(st *state.State, unit *state.Unit) error {
+	alive, err := unit.AgentPresence()
+	if err != nil {
+		return err
+	}
+	if alive {
+		return nil
+	}
 	if _, err := unit.SetAgentPresence(); err != nil {
 		return err
 	}
-	s.state.StartSync()
-	if err := unit.WaitAgentPresence(MediumWait); err != nil {
+	st.StartSync()
+	return nil
+}
+
+// Explicitly start the unit with the given name in the model with the
+// given UUID (or in the controller model), which must be allocating and
+// assigned to a machine. This is typically used in manual mode.
+func (s *FakeJujuService) StartUnit(model, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, err := s.lookupModelState(model)
+	if err != nil {
+		return err
+	}
+	unit, err := st.Unit(name)
+	if err != nil {
+		return err
+	}
+	agentStatus, err := unit.AgentStatus()
+	if err != nil {
+		return err
+	}
+	if agentStatus.Status != status.Allocating {
+		return errors.Errorf("unit %s is not allocating", name)
+	}
+	if _, err := unit.AssignedMachineId(); err != nil {
+		return err
+	}
+	return s.startUnit(st, unit)
+}
+
+// Explicitly set the agent and/or workload status of the unit with the
+// given name in the model with the given UUID (or in the controller model).
+// A nil status is left unchanged.
+func (s *FakeJujuService) SetUnitStatus(model, name string, agent, workload *params.Status) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st, err := s.lookupModelState(model)
+	if err != nil {
 		return err
 	}
+	return s.setUnitStatus(st, name, agent, workload)
+}
+
+// Set the agent and/or workload status of the unit with the given name in
+// the model of the given state.
+//
+// This method must be called with the service lock held.
+func (s *FakeJujuService) setUnitStatus(st *state.State, name string, agent, workload *params.Status) error {
+	unit, err := st.Unit(name)
+	if err != nil {
+		return err
+	}
+	if agent != nil {
+		log.Infof("Setting unit %s agent status to %s", name, agent.Status)
+		if err := unit.SetAgentStatus(jujuStatusInfo(agent)); err != nil {
+			return err
+		}
+		if status.Status(agent.Status) != status.Allocating {
+			if err := s.setUnitAgentPresence(st, unit); err != nil {
+				return err
+			}
+		}
+		s.publishTransition("unit", name, "set-agent-status", agent.Status)
+	}
+	if workload != nil {
+		log.Infof("Setting unit %s workload status to %s", name, workload.Status)
+		if err := unit.SetStatus(jujuStatusInfo(workload)); err != nil {
+			return err
+		}
+		s.publishTransition("unit", name, "set-workload-status", workload.Status)
+	}
 	return nil
 }
 
-// Mark a unit as failed (i.e. transition it to the errored state)
-func (s *FakeJujuService) errorUnit(unit *state.Unit) error {
+// Mark a unit as failed (i.e. transition it to the errored state), either
+// at the agent level (the default) or at the workload level. Pending status
+// changes of the install sequence are cancelled, so the unit stays errored.
+func (s *FakeJujuService) errorUnit(st *state.State, unit *state.Unit, failure *params.Failure) error {
 	log.Infof("Erroring unit %s", unit.Name())
+	s.cancelStatusSteps(st.ModelUUID(), unit.Name())
 
 	now := time.Now()
 
-	return unit.SetAgentStatus(status.StatusInfo{
+	info := status.StatusInfo{
 		Status:  status.Error,
-		Message: "unit errored",
+		Message: failureMessage(failure, "unit errored"),
+		Data:    failureData(failure),
 		Since:   &now,
-	})
+	}
+	var err error
+	if failure.Target == params.FailureTargetWorkload {
+		err = unit.SetStatus(info)
+	} else {
+		err = unit.SetAgentStatus(info)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.publishTransition("unit", unit.Name(), "error", string(status.Error))
+	return nil
 }
 
 // Create a machine for a unit that doesn't have one yet
-func (s *FakeJujuService) addMachineForUnit(unit *state.Unit) error {
+func (s *FakeJujuService) addMachineForUnit(st *state.State, unit *state.Unit) error {
 	log.Infof("Adding new machine for unit %s", unit.Name())
-	machine, err := s.state.AddOneMachine(state.MachineTemplate{
+	machine, err := st.AddOneMachine(state.MachineTemplate{
 		Series: s.options.Series,
 		Jobs:   []state.MachineJob{state.JobHostUnits},
 	})
@@ -110,3 +256,57 @@ func (s *FakeJujuService) addMachineForUnit(unit *state.Unit) error {
 	}
 	return unit.AssignToMachine(machine)
 }
+
+// Return a summary of all units in the model with the given UUID (or in the
+// controller model).
+func (s *FakeJujuService) Units(model string) ([]params.Unit, error) {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return nil, err
+	}
+	applications, err := st.AllApplications()
+	if err != nil {
+		return nil, err
+	}
+	infos := []params.Unit{}
+	for _, application := range applications {
+		units, err := application.AllUnits()
+		if err != nil {
+			return nil, err
+		}
+		for _, unit := range units {
+			info, err := newUnitInfo(unit)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func newUnitInfo(unit *state.Unit) (params.Unit, error) {
+	info := params.Unit{
+		Name:        unit.Name(),
+		Application: unit.ApplicationName(),
+		Life:        unit.Life().String(),
+	}
+
+	// A unit might not be assigned to a machine yet, in that case
+	// we just leave the field empty.
+	info.Machine, _ = unit.AssignedMachineId()
+
+	st, err := unit.AgentStatus()
+	if err != nil {
+		return info, err
+	}
+	info.AgentStatus = newStatus(st)
+
+	st, err = unit.Status()
+	if err != nil {
+		return info, err
+	}
+	info.WorkloadStatus = newStatus(st)
+
+	return info, nil
+}
@@ -1,10 +1,14 @@
 package service_test
 
 import (
+	"time"
+
 	gc "gopkg.in/check.v1"
 
+	"github.com/juju/juju/api/fakejuju/params"
 	"github.com/juju/juju/state"
 	"github.com/juju/juju/status"
+	jujutesting "github.com/juju/juju/testing"
 	"github.com/juju/juju/testing/factory"
 
 	"../service"
@@ -54,3 +58,114 @@ func (s *FakeJujuServiceSuite) TestWatchLoopStartUnit(c *gc.C) {
 	c.Check(err, gc.IsNil)
 	c.Check(workloadStatus.Status, gc.Equals, status.Active)
 }
+
+// The Units() method returns a summary of all units in the model.
+func (s *FakeJujuServiceSuite) TestUnits(c *gc.C) {
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+
+	units, err := s.service.Units("")
+	c.Assert(err, gc.IsNil)
+	c.Assert(units, gc.HasLen, 1)
+	c.Check(units[0].Name, gc.Equals, unit.Name())
+	c.Check(units[0].Application, gc.Equals, application.Name())
+	c.Check(units[0].Machine, gc.Equals, "")
+	c.Check(units[0].AgentStatus.Status, gc.Equals, string(status.Allocating))
+}
+
+// Units scheduled to fail get their agent status set to error, with a message
+// and data matching the given hook.
+func (s *FakeJujuServiceSuite) TestWatchLoopErrorUnitHook(c *gc.C) {
+	s.service.SetFailure("unit-mysql-0", &params.Failure{Hook: "config-changed"})
+
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+
+	// The agent error is reported as the unit status, since the agent
+	// status itself is reported as idle when in error.
+	var unitStatus status.StatusInfo
+	for a := jujutesting.LongAttempt.Start(); a.Next(); {
+		s.BackingState.StartSync()
+		unitStatus, err = unit.Status()
+		c.Assert(err, gc.IsNil)
+		if unitStatus.Status == status.Error {
+			break
+		}
+	}
+	c.Check(unitStatus.Status, gc.Equals, status.Error)
+	c.Check(unitStatus.Message, gc.Equals, `hook failed: "config-changed"`)
+	c.Check(unitStatus.Data, gc.DeepEquals, map[string]interface{}{
+		"hook": "config-changed",
+	})
+}
+
+// A unit that fails while going through a delayed install sequence stays
+// in error, instead of being brought back to active by the pending steps.
+func (s *FakeJujuServiceSuite) TestWatchLoopErrorUnitInstallSequence(c *gc.C) {
+	options := &service.FakeJujuOptions{
+		Mongo:           -1,
+		Series:          "xenial",
+		InstallSequence: service.DefaultInstallSequence(100 * time.Millisecond),
+	}
+	s.service = service.NewFakeJujuService(s.BackingState, s.APIState, options)
+	s.service.SetFailure("unit-mysql-0", &params.Failure{Hook: "install"})
+	s.service.Start()
+	defer s.service.Stop()
+
+	machine, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "quantal",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	charm := s.Factory.MakeCharm(c, &factory.CharmParams{
+		Name:   "mysql",
+		Series: "quantal",
+	})
+	application := s.Factory.MakeApplication(c, &factory.ApplicationParams{
+		Name:  "mysql",
+		Charm: charm,
+	})
+	unit, err := application.AddUnit()
+	c.Assert(err, gc.IsNil)
+	c.Assert(unit.AssignToMachine(machine), gc.IsNil)
+	s.BackingState.StartSync()
+
+	condition, err := service.ParseCondition("unit mysql/0 workload=error")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+
+	// The rest of the install sequence would have been played by now.
+	condition, err = service.ParseCondition("unit mysql/0 workload=active")
+	c.Assert(err, gc.IsNil)
+	result, err = s.service.WaitFor("", condition, time.Second)
+	c.Assert(err, gc.IsNil)
+	c.Check(result.Matched, gc.Equals, false)
+	unitStatus, err := unit.Status()
+	c.Assert(err, gc.IsNil)
+	c.Check(unitStatus.Status, gc.Equals, status.Error)
+}
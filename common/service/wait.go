@@ -0,0 +1,238 @@
+// Block until entities reach a certain state
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+)
+
+// How often conditions get re-checked while waiting, in addition to
+// checking them whenever an event is published.
+const waitPollInterval = 500 * time.Millisecond
+
+// The fields that conditions can match, for each entity kind.
+var conditionFields = map[string][]string{
+	"machine": {"status", "message", "instance-status", "instance-message", "instance-id", "life"},
+	"unit":    {"agent", "agent-message", "workload", "workload-message", "machine", "life"},
+	"action":  {"status", "message"},
+}
+
+// A condition on the state of an entity, for example "unit mysql/0
+// workload=active" or "action 3 status=completed".
+type Condition struct {
+	Kind   string
+	Id     string
+	Fields map[string]string
+}
+
+// Parse a condition in the form "<kind> <id> <field>=<value>...". All
+// field values must match for the condition to be satisfied. Values
+// containing spaces must be double-quoted, using Go string syntax, e.g.
+// `unit mysql/0 workload-message="missing relations: db"`.
+func ParseCondition(text string) (*Condition, error) {
+	parts, err := splitCondition(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) < 3 {
+		return nil, errors.NotValidf("condition %q", text)
+	}
+	condition := &Condition{
+		Kind:   parts[0],
+		Id:     parts[1],
+		Fields: make(map[string]string),
+	}
+	fields, ok := conditionFields[condition.Kind]
+	if !ok {
+		return nil, errors.NotValidf("entity kind %q", condition.Kind)
+	}
+	for _, part := range parts[2:] {
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 || !containsString(fields, pair[0]) {
+			return nil, errors.NotValidf("%s condition %q", condition.Kind, part)
+		}
+		condition.Fields[pair[0]] = pair[1]
+	}
+	return condition, nil
+}
+
+func (c *Condition) String() string {
+	pairs := []string{c.Kind, c.Id}
+	for _, field := range conditionFields[c.Kind] {
+		if value, ok := c.Fields[field]; ok {
+			if value == "" || strings.ContainsAny(value, " \t\"") {
+				value = strconv.Quote(value)
+			}
+			pairs = append(pairs, fmt.Sprintf("%s=%s", field, value))
+		}
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Split a condition on whitespace, unquoting the double-quoted values of
+// the fields.
+func splitCondition(condition string) ([]string, error) {
+	var parts []string
+	for text := strings.TrimSpace(condition); text != ""; text = strings.TrimSpace(text) {
+		end := strings.IndexAny(text, " \t\n")
+		if end == -1 {
+			end = len(text)
+		}
+		part := text[:end]
+		if i := strings.Index(part, "=\""); i != -1 {
+			// The quoted value can contain spaces, so look for the
+			// closing quote.
+			end = closingQuote(text, i+2) + 1
+			value, err := strconv.Unquote(text[i+1 : end])
+			if err != nil || (end < len(text) && !strings.ContainsAny(text[end:end+1], " \t\n")) {
+				return nil, errors.NotValidf("quoted value in condition %q", condition)
+			}
+			part = text[:i+1] + value
+		}
+		parts = append(parts, part)
+		text = text[end:]
+	}
+	return parts, nil
+}
+
+// Return the index of the first unescaped double quote in the given text,
+// starting at the given index, or the index of the last character if
+// there's none.
+func closingQuote(text string, start int) int {
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return len(text) - 1
+}
+
+// Block until the given condition is satisfied in the model with the given
+// UUID (or in the controller model), or the timeout expires. In the latter
+// case the returned result won't be marked as matched, and will contain the
+// last observed state of the entity.
+func (s *FakeJujuService) WaitFor(model string, condition *Condition, timeout time.Duration) (*params.WaitResult, error) {
+	st, err := s.getModelState(model)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Waiting for %s", condition)
+
+	events := s.Subscribe()
+	defer s.Unsubscribe(events)
+
+	deadline := time.After(timeout)
+	for {
+		result, err := checkCondition(st, condition)
+		if err != nil || result.Matched {
+			return result, err
+		}
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return result, errors.New("service stopped")
+			}
+		case <-time.After(waitPollInterval):
+		case <-deadline:
+			log.Infof("Timeout waiting for %s", condition)
+			return checkCondition(st, condition)
+		}
+	}
+}
+
+// Check whether the given condition is currently satisfied in the model of
+// the given state.
+func checkCondition(st *state.State, condition *Condition) (*params.WaitResult, error) {
+	info, values, err := observe(st, condition.Kind, condition.Id)
+	if errors.IsNotFound(err) {
+		// The entity might show up later.
+		return &params.WaitResult{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	result := &params.WaitResult{Matched: true, State: data}
+	for field, value := range condition.Fields {
+		if values[field] != value {
+			result.Matched = false
+		}
+	}
+	return result, nil
+}
+
+// Return the info about the given entity of the model of the given state,
+// along with the values of the fields that conditions can match.
+func observe(st *state.State, kind, id string) (interface{}, map[string]string, error) {
+	switch kind {
+	case "machine":
+		machine, err := st.Machine(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		info, err := newMachineInfo(machine)
+		if err != nil {
+			return nil, nil, err
+		}
+		return info, map[string]string{
+			"status":           info.Status.Status,
+			"message":          info.Status.Message,
+			"instance-status":  info.InstanceStatus.Status,
+			"instance-message": info.InstanceStatus.Message,
+			"instance-id":      info.InstanceId,
+			"life":             info.Life,
+		}, nil
+	case "unit":
+		unit, err := st.Unit(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		info, err := newUnitInfo(unit)
+		if err != nil {
+			return nil, nil, err
+		}
+		return info, map[string]string{
+			"agent":            info.AgentStatus.Status,
+			"agent-message":    info.AgentStatus.Message,
+			"workload":         info.WorkloadStatus.Status,
+			"workload-message": info.WorkloadStatus.Message,
+			"machine":          info.Machine,
+			"life":             info.Life,
+		}, nil
+	case "action":
+		action, err := st.Action(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		info := newActionInfo(action)
+		return info, map[string]string{
+			"status":  info.Status,
+			"message": info.Message,
+		}, nil
+	}
+	return nil, nil, errors.NotValidf("entity kind %q", kind)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
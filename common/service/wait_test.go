@@ -0,0 +1,84 @@
+package service_test
+
+import (
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/api/fakejuju/params"
+	"github.com/juju/juju/state"
+	jujutesting "github.com/juju/juju/testing"
+
+	"../service"
+)
+
+// Conditions are parsed from their textual representation.
+func (s *FakeJujuServiceSuite) TestParseCondition(c *gc.C) {
+	condition, err := service.ParseCondition("unit mysql/0 workload=active agent=idle")
+	c.Assert(err, gc.IsNil)
+	c.Check(condition.Kind, gc.Equals, "unit")
+	c.Check(condition.Id, gc.Equals, "mysql/0")
+	c.Check(condition.Fields, gc.DeepEquals, map[string]string{
+		"workload": "active",
+		"agent":    "idle",
+	})
+	c.Check(condition.String(), gc.Equals, "unit mysql/0 agent=idle workload=active")
+
+	_, err = service.ParseCondition("unit mysql/0")
+	c.Check(err, gc.ErrorMatches, `condition "unit mysql/0" not valid`)
+	_, err = service.ParseCondition("unit mysql/0 foo=bar")
+	c.Check(err, gc.ErrorMatches, `unit condition "foo=bar" not valid`)
+	_, err = service.ParseCondition("relation 1 status=joined")
+	c.Check(err, gc.ErrorMatches, `entity kind "relation" not valid`)
+
+	// Values containing spaces can be quoted.
+	condition, err = service.ParseCondition(`unit wordpress/0 workload-message="missing relations: db" workload=blocked`)
+	c.Assert(err, gc.IsNil)
+	c.Check(condition.Fields, gc.DeepEquals, map[string]string{
+		"workload":         "blocked",
+		"workload-message": "missing relations: db",
+	})
+	c.Check(condition.String(), gc.Equals, `unit wordpress/0 workload=blocked workload-message="missing relations: db"`)
+	_, err = service.ParseCondition(`unit wordpress/0 workload-message="missing`)
+	c.Check(err, gc.ErrorMatches, `quoted value in condition .* not valid`)
+}
+
+// WaitFor blocks until the condition is satisfied.
+func (s *FakeJujuServiceSuite) TestWaitFor(c *gc.C) {
+	s.service.Start()
+	defer s.service.Stop()
+
+	_, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+	s.BackingState.StartSync()
+
+	condition, err := service.ParseCondition("machine 0 status=started")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, jujutesting.LongWait)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, true)
+	machine := params.Machine{}
+	c.Assert(result.Decode(&machine), gc.IsNil)
+	c.Check(machine.InstanceId, gc.Equals, "id-1")
+}
+
+// If the timeout expires, WaitFor returns the last observed state.
+func (s *FakeJujuServiceSuite) TestWaitForTimeout(c *gc.C) {
+	_, err := s.BackingState.AddOneMachine(state.MachineTemplate{
+		Series: "xenial",
+		Jobs:   []state.MachineJob{state.JobHostUnits},
+	})
+	c.Assert(err, gc.IsNil)
+
+	condition, err := service.ParseCondition("machine 0 status=started")
+	c.Assert(err, gc.IsNil)
+	result, err := s.service.WaitFor("", condition, 100*time.Millisecond)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Matched, gc.Equals, false)
+	machine := params.Machine{}
+	c.Assert(result.Decode(&machine), gc.IsNil)
+	c.Check(machine.Status.Status, gc.Equals, "pending")
+}
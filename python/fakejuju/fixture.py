@@ -114,13 +114,16 @@ class FakeJuju(Service):
         """Mark the given entity as failing.
 
         It will be transitioned to the error state as soon as it gets created.
-
-        Currently only failing units is supported.
+        Failures can be set before bootstrap: failing "machine-0" makes the
+        controller bootstrap fail.
 
         :param entity: A string of the form "<kind>-<id>", for example
-            "unit-postgresql-1".
+            "unit-postgresql-1" or "machine-1".
+        :raises requests.HTTPError: If fake-juju rejected the request.
         """
-        requests.post("http://localhost:{}/fail/{}".format(self.port, entity))
+        response = requests.post(
+            "http://localhost:{}/fail/{}".format(self.port, entity))
+        response.raise_for_status()
 
     def _extraArgs(self):
         return [